@@ -145,6 +145,21 @@ def profile(func):
     return func
 
 
+def stream_chunks(func):
+    """Mark a join function as taking iterators over the chunk definitions
+    and chunk outputs, rather than lists, so that joins over many chunks
+    need not hold them all in memory at once.  For example
+
+    @martian.stream_chunks
+    def join(args, outs, chunk_defs, chunk_outs):
+        for chunk_def, chunk_out in zip(chunk_defs, chunk_outs):
+            ...
+
+    The iterators may each only be traversed once."""
+    func.stream_chunks = True
+    return func
+
+
 # On linux, provide a method to set PDEATHSIG on child processes.
 if sys.platform.startswith('linux'):
     import ctypes
@@ -179,6 +179,9 @@ class _MemoryProfile(object):
 
 _METADATA_PREFIX = '_'
 
+# The first line of arrays which mrp writes with one element per line.
+_LINES_ARRAY_HEADER = '[ \n'
+
 
 class _Metadata(object):
     """Utility methods to read and write martian metadata files used for
@@ -224,6 +227,27 @@ class _Metadata(object):
                 sys.stderr.write(str(read_error))
                 return {}
 
+    def iter_array(self, name):
+        """Iterate over the elements of the json array in the given metadata
+        file.  Arrays which mrp writes with one element per line, marked by
+        _LINES_ARRAY_HEADER, are parsed one line at a time, so that the
+        entire array is never held in memory.  Other arrays are loaded in
+        full."""
+        with open(self.make_path(name), 'r') as source:
+            if source.readline() != _LINES_ARRAY_HEADER:
+                source.seek(0)
+                for item in json.load(source):
+                    yield item
+                return
+            for line in source:
+                line = line.strip()
+                if line == ']':
+                    return
+                if line.endswith(','):
+                    line = line[:-1]
+                if line:
+                    yield json.loads(line)
+
     def write_raw(self, name, text, force=False):
         """Write the given text to the given metadata file."""
         if isinstance(text, _text_type):
@@ -554,10 +578,16 @@ class StageWrapper(object):
         if self._run_type == 'main':
             self._run(lambda: self._module.main(args, outs))
         elif self._run_type == 'join':
-            chunk_defs = [martian.Record(chunk_def)
-                          for chunk_def in self.metadata.read('chunk_defs')]
-            chunk_outs = [martian.Record(chunk_out)
-                          for chunk_out in self.metadata.read('chunk_outs')]
+            if getattr(self._module.join, 'stream_chunks', False):
+                chunk_defs = (martian.Record(chunk_def)
+                              for chunk_def in self.metadata.iter_array('chunk_defs'))
+                chunk_outs = (martian.Record(chunk_out)
+                              for chunk_out in self.metadata.iter_array('chunk_outs'))
+            else:
+                chunk_defs = [martian.Record(chunk_def)
+                              for chunk_def in self.metadata.read('chunk_defs')]
+                chunk_outs = [martian.Record(chunk_out)
+                              for chunk_out in self.metadata.read('chunk_outs')]
             self._run(lambda: self._module.join(
                 args, outs, chunk_defs, chunk_outs))
         else:
@@ -0,0 +1,177 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+
+/*
+Martian pipeline bundle tool
+
+Creates and verifies signed pipeline bundles.  A bundle is a pipeline
+directory, normally the parent of the directory given in MROPATH, with a
+manifest of checksums for all of its files and a signature of the manifest.
+mrp verifies bundles before running pipelines from them when given
+--bundle-key.
+*/
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/martian-lang/martian/martian/core"
+	"github.com/martian-lang/martian/martian/util"
+
+	"github.com/martian-lang/docopt.go"
+)
+
+func main() {
+	doc := `Martian pipeline bundle tool.
+
+Usage:
+    mrbundle keygen <key_name>
+    mrbundle create <bundle_dir> --key=FILE [--archive=FILE]
+    mrbundle verify <bundle_dir> --pubkey=FILE
+    mrbundle -h | --help | --version
+
+Commands:
+    keygen          Generate a key pair, writing the private key to
+                    <key_name>.key and the public key to <key_name>.pub.
+    create          Write the manifest and signature for a bundle.
+    verify          Verify the signature and content of a bundle.
+
+Options:
+    --key=FILE      The private key to sign the bundle with.
+    --archive=FILE  Also write the signed bundle to a .tar.gz file.
+    --pubkey=FILE   The public key to verify the bundle with.
+
+    -h --help       Show this message.
+    --version       Show version.`
+	martianVersion := util.GetVersion()
+	opts, _ := docopt.Parse(doc, nil, true, martianVersion, false)
+
+	switch {
+	case opts["keygen"].(bool):
+		keygen(opts["<key_name>"].(string))
+	case opts["create"].(bool):
+		create(opts["<bundle_dir>"].(string), opts["--key"].(string), opts["--archive"])
+	case opts["verify"].(bool):
+		verify(opts["<bundle_dir>"].(string), opts["--pubkey"].(string))
+	}
+}
+
+func fail(err error, message string) {
+	fmt.Fprintln(os.Stderr, message+":", err)
+	os.Exit(1)
+}
+
+func keygen(name string) {
+	public, private, err := core.GenerateBundleKey()
+	if err != nil {
+		fail(err, "Could not generate key")
+	}
+	if err := ioutil.WriteFile(name+".key", []byte(private+"\n"), 0600); err != nil {
+		fail(err, "Could not write private key")
+	}
+	if err := ioutil.WriteFile(name+".pub", []byte(public+"\n"), 0644); err != nil {
+		fail(err, "Could not write public key")
+	}
+	fmt.Printf("Wrote %s.key and %s.pub.\n", name, name)
+}
+
+func create(dir, keyFile string, archive interface{}) {
+	key, err := core.ReadBundlePrivateKey(keyFile)
+	if err != nil {
+		fail(err, "Could not read key")
+	}
+	manifest, err := core.SignBundle(dir, key)
+	if err != nil {
+		fail(err, "Could not sign bundle")
+	}
+	fmt.Printf("Signed %d files in %s.\n", len(manifest.Files), dir)
+	if archive != nil {
+		if err := writeArchive(dir, archive.(string)); err != nil {
+			fail(err, "Could not write archive")
+		}
+		fmt.Println("Wrote", archive.(string))
+	}
+}
+
+func verify(dir, keyFile string) {
+	key, err := core.ReadBundlePublicKey(keyFile)
+	if err != nil {
+		fail(err, "Could not read key")
+	}
+	info, err := core.VerifyBundle(dir, key)
+	if err != nil {
+		fail(err, "Verification failed")
+	}
+	if info.Version != "" {
+		fmt.Printf("Bundle %s version %s is valid.\n", dir, info.Version)
+	} else {
+		fmt.Printf("Bundle %s is valid.\n", dir)
+	}
+	fmt.Println("Manifest sha256:", info.Manifest)
+}
+
+// Writes the bundle to a gzipped tar file, under the base name of the
+// bundle directory.
+func writeArchive(dir, dest string) error {
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	dir = filepath.Clean(dir)
+	base := filepath.Base(dir)
+	if err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(filepath.Join(base, rel))
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		src, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	}); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,236 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+
+/*
+Martian pipestance deduplication tool
+
+This tool finds large files which are identical across the pipestances
+under one or more directories, for example FASTQs from a flowcell which was
+demultiplexed more than once, and replaces the duplicates with hard links to
+a single copy.  Files are only linked if their sha256 checksums match and
+they have the same owner and permissions.  Pipestances which are locked by a
+running mrp are skipped.
+*/
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"syscall"
+
+	"github.com/dustin/go-humanize"
+	"github.com/martian-lang/martian/martian/core"
+	"github.com/martian-lang/martian/martian/util"
+
+	"github.com/martian-lang/docopt.go"
+)
+
+// A file, identified by its inode.
+type dedupFile struct {
+	path  string
+	dev   uint64
+	ino   uint64
+	size  int64
+	mode  os.FileMode
+	uid   uint32
+	gid   uint32
+	mtime int64
+}
+
+type sizeKey struct {
+	dev  uint64
+	size int64
+}
+
+type dedupReport struct {
+	groups     int
+	linked     int
+	reclaimed  uint64
+	unreadable int
+}
+
+func main() {
+	doc := `Martian pipestance deduplication tool.
+
+Usage:
+    mrdedup <pipestances_root>... [options]
+    mrdedup -h | --help | --version
+
+Options:
+    --min-mb=NUM    Only consider files of at least NUM MB.  Defaults to 100.
+    --dry-run       Report duplicate files without linking them.
+
+    -h --help       Show this message.
+    --version       Show version.`
+	martianVersion := util.GetVersion()
+	opts, _ := docopt.Parse(doc, nil, true, martianVersion, false)
+
+	minSize := int64(100 * 1024 * 1024)
+	if value := opts["--min-mb"]; value != nil {
+		if value, err := strconv.Atoi(value.(string)); err != nil || value < 0 {
+			fmt.Fprintln(os.Stderr, "Invalid --min-mb value", opts["--min-mb"])
+			os.Exit(1)
+		} else {
+			minSize = int64(value) * 1024 * 1024
+		}
+	}
+	dryRun := opts["--dry-run"].(bool)
+
+	candidates := make(map[sizeKey][]*dedupFile)
+	seen := make(map[[2]uint64]bool)
+	for _, root := range opts["<pipestances_root>"].([]string) {
+		if err := findFiles(root, minSize, candidates, seen); err != nil {
+			fmt.Fprintln(os.Stderr, "Error scanning", root, ":", err)
+			os.Exit(2)
+		}
+	}
+	var report dedupReport
+	for _, files := range candidates {
+		if len(files) > 1 {
+			dedupSize(files, dryRun, &report)
+		}
+	}
+	if dryRun {
+		fmt.Printf("Found %d files in %d groups which could be linked, "+
+			"reclaiming %s.\n",
+			report.linked, report.groups, humanize.Bytes(report.reclaimed))
+	} else {
+		fmt.Printf("Linked %d files in %d groups, reclaiming %s.\n",
+			report.linked, report.groups, humanize.Bytes(report.reclaimed))
+	}
+	if report.unreadable > 0 {
+		fmt.Printf("%d files could not be read.\n", report.unreadable)
+	}
+}
+
+// Finds regular files of at least minSize bytes, grouped by device and size.
+// Files which are already hard links of each other are only listed once.
+func findFiles(root string, minSize int64,
+	candidates map[sizeKey][]*dedupFile, seen map[[2]uint64]bool) error {
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) || os.IsPermission(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			if _, err := os.Stat(filepath.Join(p, core.Lock.FileName())); err == nil {
+				fmt.Println("Skipping locked pipestance", p)
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || info.Size() < minSize {
+			return nil
+		}
+		st, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+		id := [2]uint64{uint64(st.Dev), uint64(st.Ino)}
+		if seen[id] {
+			return nil
+		}
+		seen[id] = true
+		key := sizeKey{dev: uint64(st.Dev), size: info.Size()}
+		candidates[key] = append(candidates[key], &dedupFile{
+			path:  p,
+			dev:   uint64(st.Dev),
+			ino:   uint64(st.Ino),
+			size:  info.Size(),
+			mode:  info.Mode(),
+			uid:   st.Uid,
+			gid:   st.Gid,
+			mtime: info.ModTime().UnixNano(),
+		})
+		return nil
+	})
+}
+
+func checksum(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// Links together the files with identical content among a set of files of
+// the same size.
+func dedupSize(files []*dedupFile, dryRun bool, report *dedupReport) {
+	byHash := make(map[string][]*dedupFile)
+	for _, f := range files {
+		if sum, err := checksum(f.path); err != nil {
+			report.unreadable++
+		} else {
+			byHash[sum] = append(byHash[sum], f)
+		}
+	}
+	for _, group := range byHash {
+		if len(group) < 2 {
+			continue
+		}
+		// Keep the oldest copy.
+		sort.Slice(group, func(i, j int) bool {
+			return group[i].mtime < group[j].mtime
+		})
+		keep := group[0]
+		linked := false
+		for _, f := range group[1:] {
+			if f.mode != keep.mode || f.uid != keep.uid || f.gid != keep.gid {
+				continue
+			}
+			if !dryRun {
+				if err := replaceWithLink(keep, f); err != nil {
+					fmt.Fprintln(os.Stderr, "Could not link", f.path, ":", err)
+					continue
+				}
+			}
+			fmt.Println(f.path, "->", keep.path)
+			linked = true
+			report.linked++
+			report.reclaimed += uint64(f.size)
+		}
+		if linked {
+			report.groups++
+		}
+	}
+}
+
+// Replaces dup with a hard link to keep, if neither file has changed since
+// it was scanned.  The link is created under a temporary name and renamed
+// over dup so that dup is never missing.
+func replaceWithLink(keep, dup *dedupFile) error {
+	for _, f := range [...]*dedupFile{keep, dup} {
+		info, err := os.Stat(f.path)
+		if err != nil {
+			return err
+		}
+		st, ok := info.Sys().(*syscall.Stat_t)
+		if !ok || uint64(st.Ino) != f.ino || info.Size() != f.size ||
+			info.ModTime().UnixNano() != f.mtime {
+			return fmt.Errorf("%s changed during deduplication", f.path)
+		}
+	}
+	tmp := dup.path + ".mrdedup"
+	if err := os.Link(keep.path, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dup.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
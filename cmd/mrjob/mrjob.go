@@ -122,6 +122,7 @@ func (self *runner) writeJobinfo() {
 	self.jobInfo.Host, _ = os.Hostname()
 	self.jobInfo.Pid = os.Getpid()
 	self.jobInfo.ClusterEnv = getClusterEnv()
+	self.jobInfo.Environment = core.CaptureJobEnvironment(os.Args[1])
 	if err := self.metadata.WriteAtomic(core.JobInfoFile, self.jobInfo); err != nil {
 		self.Fail(err, "Could not write updated jobInfo.")
 	}
@@ -174,6 +175,7 @@ func (self *runner) Fail(err error, message string) {
 	if writeError := self.metadata.WriteRaw(target, errStr); writeError != nil {
 		util.PrintError(writeError, "monitor", "Could not write errors file.")
 	}
+	self.flushMetadata()
 	if jErr := self.metadata.UpdateJournal(target); jErr != nil {
 		util.PrintError(jErr, "monitor", "Could not update %v journal file.", target)
 	}
@@ -181,6 +183,19 @@ func (self *runner) Fail(err error, message string) {
 	os.Exit(0)
 }
 
+// How long to wait for the filesystem to recover before giving up on
+// metadata writes which failed with transient errors.
+const metadataFlushTimeout = 15 * time.Minute
+
+// Retry metadata writes which failed during a filesystem outage, since mrp
+// would otherwise wait forever for the job's completion or error.
+func (self *runner) flushMetadata() {
+	if !core.FlushMetadataWrites(metadataFlushTimeout) {
+		util.PrintInfo("monitor", "Could not write metadata files within %s.",
+			metadataFlushTimeout)
+	}
+}
+
 // Wait for up to 15 seconds after the stage code terminates for perf record to
 // terminate (if applicable).  Otherwise some cluster managers might kill perf
 // as soon as the head process for the job (mrjob, in this case) terminates.
@@ -229,6 +244,7 @@ func (self *runner) Complete() {
 			util.PrintError(writeError, "monitor", "Could not write complete file.")
 		}
 	}
+	self.flushMetadata()
 	self.sync()
 	if jErr := self.metadata.UpdateJournal(target); jErr != nil {
 		util.PrintError(jErr, "monitor", "Could not update %v journal file.", target)
@@ -504,6 +520,12 @@ func (self *runner) monitor(lastHeartbeat *time.Time) error {
 				mem, self.jobInfo.MemGB)
 		}
 	}
+	if limit := self.jobInfo.WallTimeHours; limit > 0 &&
+		time.Since(self.start) > time.Duration(limit)*time.Hour {
+		self.job.Process.Kill()
+		return fmt.Errorf("Stage exceeded its walltime limit of %d hour%s",
+			limit, util.Pluralize(limit))
+	}
 	if time.Since(*lastHeartbeat) > HeartbeatInterval {
 		if err := self.metadata.UpdateJournal(core.Heartbeat); err != nil {
 			util.PrintError(err, "monitor", "Could not write heartbeat.")
@@ -11,6 +11,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net"
 	"net/http"
 	"net/url"
@@ -51,6 +52,11 @@ type pipestanceHolder struct {
 	readOnly         bool
 	retryWait        time.Duration
 	server           *http.Server
+	uploader         *failureUploader
+	watchdog         *stuckWatchdog
+	history          *core.PipelineHistory
+	progress         *core.ProgressEstimator
+	lastComplete     int
 }
 
 func (self *pipestanceHolder) getPipestance() *core.Pipestance {
@@ -84,6 +90,13 @@ func (self *pipestanceHolder) reset(ctx context.Context) error {
 	return self.restart(ctx)
 }
 
+// Use the given invocation source when reattaching to the pipestance.
+func (self *pipestanceHolder) setInvocation(src string) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.factory = self.factory.WithInvocation(src)
+}
+
 // Restart the pipestance.
 func (self *pipestanceHolder) restart(outerCtx context.Context) error {
 	ctx, task := trace.NewTask(outerCtx, "restart")
@@ -254,7 +267,12 @@ func loopBody(pipestanceBox *pipestanceHolder, vdrMode string, noExit bool) bool
 		pipestance.CheckHeartbeats(ctx)
 
 		// Step all nodes.
-		return pipestance.StepNodes(ctx)
+		progress := pipestance.StepNodes(ctx)
+		pipestanceBox.watchdog.check(pipestance, state, progress)
+		if progress {
+			pipestanceBox.printProgress()
+		}
+		return progress
 	}
 }
 
@@ -328,6 +346,7 @@ func cleanupCompleted(pipestance *core.Pipestance, pipestanceBox *pipestanceHold
 			killReport.Count, humanize.Bytes(killReport.Size))
 	}
 	trace.WithRegion(ctx, "PostProcess", pipestance.PostProcess)
+	pipestanceBox.recordHistory()
 	pipestance.Unlock()
 	pipestance.OnFinishHook(ctx)
 	updateComplete := pipestanceBox.UpdateState(core.Complete)
@@ -368,6 +387,7 @@ func cleanupFailed(pipestance *core.Pipestance, pipestanceBox *pipestanceHolder,
 	var serverUpdate chan struct{}
 	if !pipestanceBox.showedFailed {
 		pipestance.OnFinishHook(ctx)
+		pipestanceBox.uploader.start(pipestance, ctx)
 		if _, _, _, log, kind, errPaths := pipestance.GetFatalError(); kind == "assert" {
 			// Print preflight check failures.
 			util.Println("\n[%s] %s\n", "error", log)
@@ -381,6 +401,7 @@ func cleanupFailed(pipestance *core.Pipestance, pipestanceBox *pipestanceHolder,
 			if serverUpdate != nil {
 				<-serverUpdate
 			}
+			pipestanceBox.uploader.wait(uploadExitTimeout)
 			util.Suicide(false)
 		} else if len(errPaths) > 0 {
 			// Build relative path to _errors file
@@ -418,6 +439,7 @@ func cleanupFailed(pipestance *core.Pipestance, pipestanceBox *pipestanceHolder,
 		if serverUpdate != nil {
 			<-serverUpdate
 		}
+		pipestanceBox.uploader.wait(uploadExitTimeout)
 		util.Suicide(false)
 	}
 }
@@ -510,6 +532,7 @@ func main() {
 
 Usage:
     mrp <call.mro> <pipestance_name> [options]
+    mrp --inspect <pipestance_dir> [options]
     mrp -h | --help | --version
 
 Options:
@@ -543,6 +566,8 @@ Options:
     --auth-key=KEY      Set the authentication key required for accessing the
                         web UI.
     --noexit            Keep UI running after pipestance completes or fails.
+    --force-takeover    If the pipestance is locked by an mrp process on this
+                        host which is no longer running, take over the lock.
     --onfinish=EXEC     Run this when pipeline finishes, success or fail.
     --zip               Zip metadata files after pipestance completes.
     --tags=TAGS         Tag pipestance with comma-separated key:value pairs.
@@ -552,15 +577,39 @@ Options:
     --stackvars         Print local variables in stage code stack trace.
     --monitor           Kill jobs that exceed requested memory resources.
     --inspect           Inspect pipestance without resetting failed stages.
+                        Given only a pipestance directory, serve the UI for
+                        a pipestance which is running elsewhere or finished,
+                        without locking or modifying it.
     --debug             Enable debug logging for local job manager.
     --stest             Substitute real stages with stress-testing stage.
     --autoretry=NUM     Automatically retry failed runs up to NUM times.
     --retry-wait=SECS   Wait SECS seconds after a failure before attempting
                         automatic retry.  Defaults to 1 second.
     --overrides=JSON    JSON file supplying custom run conditions per stage.
+    --price-table=JSON  JSON file supplying compute, memory, and storage prices
+                        used to estimate the cost of the pipestance.
+    --bundle-key=FILE   Only run pipelines from bundles signed with the key
+                        whose public half is in FILE.  See mrbundle.
+    --history-dir=PATH  Directory in which to keep stage run times and
+                        resource usage from previous runs, which may be
+                        shared between pipestances.  Used to estimate the
+                        time remaining.
     --psdir=PATH        The path to the pipestance directory.  The default is
                         to use <pipestance_name>.
     --never-local       Ignore 'local' modifiers on non-preflight stages.
+    --stable-fork-ids   Name the directories for sweep forks by a hash of
+                        their sweep values rather than by index.
+    --stuck-hours=NUM   Report the pipestance as stuck if no stage changes
+                        state and no job sends a heartbeat for NUM hours.
+                            Defaults to 24 if --onstuck is given.
+    --onstuck=EXEC      Run this when the pipestance is reported as stuck.
+    --upload-on-failure=URL
+                        If the pipestance fails, upload a debug bundle of its
+                        metadata and logs to URL with an HTTP PUT.
+    --upload-max-mb=NUM Do not upload debug bundles larger than NUM MB.
+                            Defaults to 100.
+    --upload-scrub      Leave stage arguments and outputs out of uploaded
+                        debug bundles.
 
     -h --help           Show this message.
     --version           Show version.`
@@ -764,6 +813,28 @@ Options:
 		}
 	}
 
+	// Parse supplied price table file.
+	if v := opts["--price-table"]; v != nil {
+		var err error
+		config.PriceTable, err = core.ReadPriceTable(v.(string))
+		if err != nil {
+			util.PrintError(err, "startup", "Failed to parse price table file")
+			os.Exit(1)
+		}
+		util.LogInfo("options", "--price-table=%s", v.(string))
+	}
+
+	// Read the key for verifying pipeline bundles.
+	if v := opts["--bundle-key"]; v != nil {
+		var err error
+		config.BundleKey, err = core.ReadBundlePublicKey(v.(string))
+		if err != nil {
+			util.PrintError(err, "startup", "Failed to read bundle key")
+			os.Exit(1)
+		}
+		util.LogInfo("options", "--bundle-key=%s", v.(string))
+	}
+
 	// Compute stackVars flag.
 	config.StackVars = opts["--stackvars"].(bool)
 	util.LogInfo("options", "--stackvars=%v", config.StackVars)
@@ -774,16 +845,37 @@ Options:
 	config.LimitLoadavg = opts["--limit-loadavg"].(bool)
 	util.LogInfo("options", "--limit-loadavg=%v", config.LimitLoadavg)
 
+	config.StableForkIds = opts["--stable-fork-ids"].(bool)
+	util.LogInfo("options", "--stable-fork-ids=%v", config.StableForkIds)
+
+	config.ForceTakeover = opts["--force-takeover"].(bool)
+	util.LogInfo("options", "--force-takeover=%v", config.ForceTakeover)
+
 	noExit := opts["--noexit"].(bool)
 	util.LogInfo("options", "--noexit=%v", noExit)
 
 	config.SkipPreflight = opts["--nopreflight"].(bool)
 	util.LogInfo("options", "--nopreflight=%v", config.SkipPreflight)
 
-	psid := opts["<pipestance_name>"].(string)
-	invocationPath := opts["<call.mro>"].(string)
-	pipestancePath := path.Join(cwd, psid)
-	if value := opts["--psdir"]; value != nil {
+	// In observer mode, attach to an existing pipestance directory using its
+	// preprocessed source, so that the original mro path is not needed.
+	observer := false
+	var psid, invocationPath, pipestancePath string
+	if value := opts["<pipestance_dir>"]; value != nil {
+		observer = true
+		pipestancePath = value.(string)
+		if !filepath.IsAbs(pipestancePath) {
+			pipestancePath = path.Join(cwd, pipestancePath)
+		}
+		pipestancePath = path.Clean(pipestancePath)
+		psid = path.Base(pipestancePath)
+		invocationPath = path.Join(pipestancePath, core.MroSourceFile.FileName())
+	} else {
+		psid = opts["<pipestance_name>"].(string)
+		invocationPath = opts["<call.mro>"].(string)
+		pipestancePath = path.Join(cwd, psid)
+	}
+	if value := opts["--psdir"]; value != nil && !observer {
 		if p, ok := value.(string); ok && p != "" {
 			if filepath.IsAbs(p) {
 				pipestancePath = p
@@ -793,7 +885,7 @@ Options:
 		}
 	}
 	stepSecs := 3 * time.Second
-	checkSrc := true
+	checkSrc := !observer
 	config.Monitor = opts["--monitor"].(bool)
 	readOnly := opts["--inspect"].(bool)
 	config.Debug = opts["--debug"].(bool)
@@ -829,6 +921,55 @@ Options:
 			}
 		}
 	}
+	var uploader *failureUploader
+	if value := opts["--upload-on-failure"]; value != nil {
+		uploader = &failureUploader{
+			url:      value.(string),
+			maxBytes: 100 * 1024 * 1024,
+			scrub:    opts["--upload-scrub"].(bool),
+		}
+		// Don't log the URL itself, since it may contain credentials.
+		util.LogInfo("options", "--upload-on-failure given")
+		if value := opts["--upload-max-mb"]; value != nil {
+			if value, err := strconv.Atoi(value.(string)); err == nil {
+				uploader.maxBytes = int64(value) * 1024 * 1024
+				util.LogInfo("options", "--upload-max-mb=%d", value)
+			} else {
+				util.PrintError(err, "options",
+					"Could not parse --upload-max-mb value \"%s\"", opts["--upload-max-mb"].(string))
+				os.Exit(1)
+			}
+		}
+	}
+	historyDir := ""
+	if value := opts["--history-dir"]; value != nil {
+		historyDir = value.(string)
+		util.LogInfo("options", "--history-dir=%s", historyDir)
+	}
+	var watchdog *stuckWatchdog
+	if value := opts["--stuck-hours"]; value != nil {
+		hours, err := strconv.ParseFloat(value.(string), 64)
+		if err != nil || !(hours > 0) ||
+			hours > float64(math.MaxInt64)/float64(time.Hour) {
+			util.PrintInfo("options",
+				"--stuck-hours must be a positive number, not \"%s\".",
+				value.(string))
+			fmt.Println(doc)
+			os.Exit(1)
+		}
+		watchdog = &stuckWatchdog{
+			timeout: time.Duration(hours * float64(time.Hour)),
+		}
+		util.LogInfo("options", "--stuck-hours=%g", hours)
+	}
+	if value := opts["--onstuck"]; value != nil {
+		if watchdog == nil {
+			watchdog = &stuckWatchdog{timeout: 24 * time.Hour}
+		}
+		watchdog.onStuck = value.(string)
+		core.VerifyOnFinish(watchdog.onStuck)
+		util.LogInfo("options", "--onstuck=%s", watchdog.onStuck)
+	}
 	// Validate psid.
 	util.DieIf(util.ValidateID(psid))
 
@@ -862,7 +1003,15 @@ Options:
 
 	// Attempt to reattach to the pipestance.
 	reattaching := false
-	pipestance, err := factory.InvokePipeline()
+	var pipestance *core.Pipestance
+	if observer {
+		pipestance, err = factory.ReattachToPipestance(context.Background())
+		util.DieIf(err)
+		config.MartianVersion, mroVersion, _ = pipestance.GetVersions()
+		reattaching = true
+	} else {
+		pipestance, err = factory.InvokePipeline()
+	}
 	if err != nil {
 		if _, ok := err.(*core.PipestanceExistsError); ok {
 			if pipestance, err = factory.ReattachToPipestance(context.Background()); err == nil {
@@ -882,11 +1031,24 @@ Options:
 		remainingRetries: retries,
 		readOnly:         readOnly,
 		retryWait:        retryWait,
+		uploader:         uploader,
+		watchdog:         watchdog,
+	}
+	if historyDir != "" {
+		if history, err := core.LoadPipelineHistory(historyDir,
+			pipestance.GetPname(), mroVersion); err != nil {
+			util.PrintError(err, "runtime",
+				"Could not load stage history.  Time remaining will not be estimated.")
+		} else {
+			pipestanceBox.history = history
+			pipestanceBox.progress = core.NewProgressEstimator(history)
+		}
 	}
 
 	if !readOnly {
 		// Start writing (including cached entries) to log file.
 		util.LogTee(path.Join(pipestancePath, "_log"))
+		util.SetCrashReportPath(path.Join(pipestancePath, "_crashreport"))
 	}
 	if bSize, inodes, fstype, err := core.GetAvailableSpace(pipestancePath); err != nil {
 		util.PrintError(err, "filesys", "Error reading filesystem information.")
@@ -998,8 +1160,16 @@ Options:
 	//=========================================================================
 	// Start run loop.
 	//=========================================================================
-	go runLoop(&pipestanceBox, stepSecs, config.VdrMode, noExit,
-		rt.LocalJobManager.Done())
+	go func() {
+		// A panic in the run loop would otherwise leave the UI up but the
+		// pipestance silently stalled.
+		if !util.RunWithRestart("runtime", 5, 10*time.Second, func() {
+			runLoop(&pipestanceBox, stepSecs, config.VdrMode, noExit,
+				rt.LocalJobManager.Done())
+		}) {
+			util.Suicide(false)
+		}
+	}()
 
 	// Let daemons take over.
 	runtime.Goexit()
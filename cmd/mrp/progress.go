@@ -0,0 +1,56 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+// Progress reporting based on stage run times from previous runs.
+//
+
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+const progressBarWidth = 20
+
+// Print a progress bar and the estimated time remaining, if the number of
+// completed stages has changed.
+func (self *pipestanceHolder) printProgress() {
+	if self.progress == nil {
+		return
+	}
+	est := self.progress.Estimate(self.getPipestance())
+	if est.TotalStages == 0 || est.CompleteStages == self.lastComplete {
+		return
+	}
+	self.lastComplete = est.CompleteStages
+	done := progressBarWidth * est.CompleteStages / est.TotalStages
+	bar := strings.Repeat("#", done) + strings.Repeat(".", progressBarWidth-done)
+	if est.UnknownStages == est.TotalStages-est.CompleteStages {
+		util.PrintInfo("runtime", "[%s] %d/%d stages complete.",
+			bar, est.CompleteStages, est.TotalStages)
+		return
+	}
+	remaining := time.Duration(est.Remaining * float64(time.Second)).Round(time.Minute)
+	if est.UnknownStages > 0 {
+		util.PrintInfo("runtime",
+			"[%s] %d/%d stages complete, at least %s remaining.",
+			bar, est.CompleteStages, est.TotalStages, remaining)
+	} else {
+		util.PrintInfo("runtime",
+			"[%s] %d/%d stages complete, about %s remaining.",
+			bar, est.CompleteStages, est.TotalStages, remaining)
+	}
+}
+
+// Add the stage run times of the completed pipestance to the history.
+func (self *pipestanceHolder) recordHistory() {
+	if self.history == nil {
+		return
+	}
+	if err := self.history.RecordPipestance(self.getPipestance()); err != nil {
+		util.PrintError(err, "runtime", "Could not save stage history.")
+	}
+}
@@ -0,0 +1,124 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+// Upload of debug bundles for failed pipestances.
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/martian-lang/martian/martian/api"
+	"github.com/martian-lang/martian/martian/core"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// How long mrp waits for a debug bundle upload to finish before exiting.
+const uploadExitTimeout = 2 * time.Minute
+
+// Settings for uploading a debug bundle when a pipestance fails.
+type failureUploader struct {
+	// The URL to PUT the bundle to.  For S3, this should be a presigned URL.
+	url string
+
+	// Bundles larger than this are not uploaded.
+	maxBytes int64
+
+	// Leave out metadata files which contain stage arguments or outputs.
+	scrub bool
+
+	// Closed when the most recently started upload finishes.
+	done chan struct{}
+}
+
+// Start uploading the debug bundle for the pipestance in the background.
+func (self *failureUploader) start(pipestance *core.Pipestance, ctx context.Context) {
+	if self == nil || self.url == "" {
+		return
+	}
+	done := make(chan struct{})
+	self.done = done
+	go func() {
+		defer close(done)
+		self.upload(pipestance, ctx)
+	}()
+}
+
+// Wait up to the given timeout for the upload started by start to finish.
+func (self *failureUploader) wait(timeout time.Duration) {
+	if self == nil || self.done == nil {
+		return
+	}
+	select {
+	case <-self.done:
+	case <-time.After(timeout):
+		util.PrintInfo("upload",
+			"Debug bundle upload did not finish within %s.  Giving up.",
+			timeout)
+	}
+}
+
+// Assemble the debug bundle for the pipestance and upload it.
+func (self *failureUploader) upload(pipestance *core.Pipestance, ctx context.Context) {
+	if self == nil || self.url == "" {
+		return
+	}
+	f, err := ioutil.TempFile("", "mrp-debug-*.tar.gz")
+	if err != nil {
+		util.PrintError(err, "upload", "Could not create debug bundle.")
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if err := api.WriteDebugBundle(f, pipestance.GetPath(), self.scrub); err != nil {
+		util.PrintError(err, "upload", "Could not create debug bundle.")
+		return
+	}
+	size, err := f.Seek(0, 1)
+	if err != nil {
+		util.PrintError(err, "upload", "Could not create debug bundle.")
+		return
+	}
+	if self.maxBytes > 0 && size > self.maxBytes {
+		util.PrintInfo("upload",
+			"Debug bundle is %s, which is larger than the %s limit.  Not uploading.",
+			humanize.Bytes(uint64(size)), humanize.Bytes(uint64(self.maxBytes)))
+		return
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		util.PrintError(err, "upload", "Could not read debug bundle.")
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodPut, self.url, f)
+	if err != nil {
+		util.PrintError(err, "upload", "Invalid upload URL.")
+		return
+	}
+	req = req.WithContext(ctx)
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/gzip")
+	util.PrintInfo("upload", "Uploading %s debug bundle.",
+		humanize.Bytes(uint64(size)))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		util.PrintError(err, "upload", "Debug bundle upload failed.")
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		util.PrintError(fmt.Errorf("%s: %s", resp.Status, body),
+			"upload", "Debug bundle upload failed.")
+		return
+	}
+	util.PrintInfo("upload", "Debug bundle uploaded.")
+}
@@ -0,0 +1,99 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+// Detection of pipestances which have stopped making progress.
+//
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/martian-lang/martian/martian/core"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// Watches for a running pipestance which has had no stage state changes
+// and no job heartbeats for a period of time.
+type stuckWatchdog struct {
+	// How long the pipestance may go without progress before it is
+	// reported as stuck.
+	timeout time.Duration
+
+	// An executable to run when the pipestance is stuck.
+	onStuck string
+
+	lastProgress time.Time
+	lastBeat     time.Time
+	lastState    core.MetadataState
+	reported     bool
+}
+
+// Update the watchdog after a step of the run loop.  Progress is true if
+// any nodes changed state during the step.
+func (self *stuckWatchdog) check(pipestance *core.Pipestance,
+	state core.MetadataState, progress bool) {
+	if self == nil {
+		return
+	}
+	now := time.Now()
+	beat, active := pipestance.GetActivity()
+	if progress || state != self.lastState || beat.After(self.lastBeat) ||
+		self.lastProgress.IsZero() {
+		self.lastProgress = now
+		self.lastBeat = beat
+		self.lastState = state
+		if self.reported {
+			self.reported = false
+			util.PrintInfo("watchdog", "Pipestance is making progress again.")
+		}
+		return
+	}
+	if self.reported || now.Sub(self.lastProgress) < self.timeout {
+		return
+	}
+	self.reported = true
+	waiting := "no running stages"
+	if len(active) > 0 {
+		waiting = strings.Join(active, ", ")
+	}
+	util.PrintInfo("watchdog",
+		"No progress for %s.  The pipestance may be stuck waiting on %s.",
+		now.Sub(self.lastProgress).Round(time.Minute).String(), waiting)
+	if self.onStuck != "" {
+		go self.runHook(pipestance, active)
+	}
+}
+
+// Run the onstuck handler, with arguments
+//
+//	$1 = path to pipestance
+//	$2 = stuck
+//	$3 = pipestance ID
+//	$4... = fqnames of the queued or running stages
+func (self *stuckWatchdog) runHook(pipestance *core.Pipestance, active []string) {
+	realPath, err := exec.LookPath(self.onStuck)
+	if err != nil {
+		util.LogError(err, "watchdog", "Could not find %s", self.onStuck)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	args := append([]string{
+		pipestance.GetPath(), "stuck", pipestance.GetPsid(),
+	}, active...)
+	cmd := exec.CommandContext(ctx, realPath, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = util.Pdeathsig(
+		new(syscall.SysProcAttr),
+		syscall.SIGINT)
+	if err := cmd.Run(); err != nil {
+		util.LogError(err, "watchdog", "Onstuck handler %s failed", realPath)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -95,9 +96,10 @@ func (self *mrpWebServer) Start() {
 		}
 	})
 	api.EnableDebug(sm, self.verifyAuth)
+	api.EnableHealthChecks(sm, self.healthChecks(), self.readyChecks())
 
 	self.pipestanceBox.server = &http.Server{
-		Handler:      sm,
+		Handler:      recoverHandler(sm),
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 65 * time.Second,
 		IdleTimeout:  time.Minute,
@@ -112,6 +114,53 @@ func (self *mrpWebServer) Start() {
 	}
 }
 
+// Reports panics in request handlers and returns an error to the client
+// rather than dropping the connection.
+func recoverHandler(source http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer func() {
+			if r := recover(); r != nil {
+				if r == http.ErrAbortHandler {
+					panic(r)
+				}
+				util.ReportPanic("webserv", r)
+				http.Error(w, "Internal server error.", http.StatusInternalServerError)
+			}
+		}()
+		source.ServeHTTP(w, req)
+	})
+}
+
+// Checks for whether mrp is alive and able to make progress.
+func (self *mrpWebServer) healthChecks() map[string]api.HealthCheck {
+	return map[string]api.HealthCheck{
+		"pipestance": func() error {
+			if self.pipestanceBox.getPipestance() == nil {
+				return errors.New("no pipestance loaded")
+			}
+			return nil
+		},
+		"disk": func() error {
+			if ps := self.pipestanceBox.getPipestance(); ps != nil {
+				return core.CheckMinimalSpace(ps.GetPath())
+			}
+			return nil
+		},
+	}
+}
+
+// Checks for whether the web server is ready to serve the UI.
+func (self *mrpWebServer) readyChecks() map[string]api.HealthCheck {
+	return map[string]api.HealthCheck{
+		"ui": func() error {
+			if self.graphPage == nil {
+				return errors.New("graph page not loaded")
+			}
+			return nil
+		},
+	}
+}
+
 // Checks that the request includes a valid authentication token, if required.
 // If it does not, it writes an error to the response and returns false.
 func (self *mrpWebServer) verifyAuth(w http.ResponseWriter, req *http.Request) bool {
@@ -223,6 +272,27 @@ func (self *mrpWebServer) handleApi(sm *http.ServeMux) {
 	sm.HandleFunc(api.QueryListMetadataTop, self.listMetadataTop)
 	sm.HandleFunc(api.QueryListMetadataTop+"/", self.listMetadataTop)
 	sm.HandleFunc(api.QueryKill, self.kill)
+	sm.HandleFunc(api.QueryCompare, self.compare)
+	sm.HandleFunc(api.QueryCompare+"/", self.compare)
+	sm.HandleFunc(api.QueryCompareEnvironment, self.compareEnvironment)
+	sm.HandleFunc(api.QueryDebugBundle, self.debugBundle)
+	sm.HandleFunc(api.QueryDebugBundle+"/", self.debugBundle)
+	sm.HandleFunc(api.QueryGetGraph, self.getGraph)
+	sm.HandleFunc(api.QueryGetGraph+"/", self.getGraph)
+	sm.HandleFunc(api.QueryGetTimeline, self.getTimeline)
+	sm.HandleFunc(api.QueryGetTimeline+"/", self.getTimeline)
+	sm.HandleFunc(api.QueryGetQueueStats, self.getQueueStats)
+	sm.HandleFunc(api.QueryGetQueueStats+"/", self.getQueueStats)
+	sm.HandleFunc(api.QueryGetForkSummary, self.getForkSummary)
+	sm.HandleFunc(api.QueryGetForkSummary+"/", self.getForkSummary)
+	sm.HandleFunc(api.QueryGetProgress, self.getProgress)
+	sm.HandleFunc(api.QueryGetProgress+"/", self.getProgress)
+	sm.HandleFunc(api.QueryGetInvocation, self.getInvocation)
+	sm.HandleFunc(api.QueryGetInvocation+"/", self.getInvocation)
+	sm.HandleFunc(api.QueryValidateInvocation, self.validateInvocation)
+	sm.HandleFunc(api.QueryValidateInvocation+"/", self.validateInvocation)
+	sm.HandleFunc(api.QueryApplyInvocation, self.applyInvocation)
+	sm.HandleFunc(api.QueryApplyInvocation+"/", self.applyInvocation)
 	sm.Handle(api.QueryExtras, self.authorize(noDot(
 		http.FileServer(http.Dir(path.Join(p, "extras"))))))
 }
@@ -358,6 +428,176 @@ func (self *mrpWebServer) getPerf(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// Get the pipeline graph: nodes with their state and progress, and edges
+// with the argument bindings which created them.
+func (self *mrpWebServer) getGraph(w http.ResponseWriter, req *http.Request) {
+	if self.readAuth && !self.verifyAuth(w, req) {
+		return
+	}
+	pipestance := self.pipestanceBox.getPipestance()
+	graph := api.MakePipelineGraph(getFinalState(self.rt, pipestance))
+	self.writeGzipJson(w, req, graph)
+}
+
+// Get start and end times and queue wait for every job in the pipestance.
+func (self *mrpWebServer) getTimeline(w http.ResponseWriter, req *http.Request) {
+	if self.readAuth && !self.verifyAuth(w, req) {
+		return
+	}
+	pipestance := self.pipestanceBox.getPipestance()
+	timeline := api.MakeTimeline(
+		getFinalState(self.rt, pipestance),
+		getPerf(self.rt, pipestance))
+	self.writeGzipJson(w, req, timeline)
+}
+
+// Get the distribution of queue wait times for the pipestance's jobs.
+func (self *mrpWebServer) getQueueStats(w http.ResponseWriter, req *http.Request) {
+	if self.readAuth && !self.verifyAuth(w, req) {
+		return
+	}
+	pipestance := self.pipestanceBox.getPipestance()
+	self.writeGzipJson(w, req, api.MakeQueueStats(getPerf(self.rt, pipestance)))
+}
+
+// Get the sweep values and outputs of each fork of the node given by the
+// "fqname" form value.
+func (self *mrpWebServer) getForkSummary(w http.ResponseWriter, req *http.Request) {
+	if self.readAuth && !self.verifyAuth(w, req) {
+		return
+	}
+	pipestance := self.pipestanceBox.getPipestance()
+	summary := pipestance.GetForkSummaries(req.FormValue("fqname"))
+	if summary == nil {
+		http.NotFound(w, req)
+		return
+	}
+	self.writeGzipJson(w, req, summary)
+}
+
+// Get the estimated time remaining for the pipestance, based on the run
+// times of stages in previous runs of the pipeline.
+func (self *mrpWebServer) getProgress(w http.ResponseWriter, req *http.Request) {
+	if self.readAuth && !self.verifyAuth(w, req) {
+		return
+	}
+	if self.pipestanceBox.progress == nil {
+		http.Error(w, "Stage history is not enabled.", http.StatusNotFound)
+		return
+	}
+	self.writeGzipJson(w, req, self.pipestanceBox.progress.Estimate(
+		self.pipestanceBox.getPipestance()))
+}
+
+// Get the invocation mro source the pipestance was started with.
+func (self *mrpWebServer) getInvocation(w http.ResponseWriter, req *http.Request) {
+	if self.readAuth && !self.verifyAuth(w, req) {
+		return
+	}
+	pipestance := self.pipestanceBox.getPipestance()
+	http.ServeFile(w, req, path.Join(pipestance.GetPath(),
+		core.InvocationFile.FileName()))
+}
+
+// Maximum size of an invocation accepted for validation.
+const maxInvocationSize = 1024 * 1024
+
+// Compile the mro source in the request body against the pipestance's mro
+// path, and report whether it is a valid invocation equivalent to the one
+// the pipestance was started with.
+func (self *mrpWebServer) validateInvocation(w http.ResponseWriter, req *http.Request) {
+	// Compiling reads files from the mro path, so always require
+	// authentication.  The source is the request body, so the auth key
+	// must be given in the query string.
+	if !self.verifyAuth(w, req) {
+		return
+	}
+	if req.Method != http.MethodPost {
+		http.Error(w, "Expected POST", http.StatusMethodNotAllowed)
+		return
+	}
+	src, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxInvocationSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pipestance := self.pipestanceBox.getPipestance()
+	self.writeGzipJson(w, req, api.ValidateInvocation(pipestance, string(src)))
+}
+
+// Replace the invocation with the mro source in the request body, and
+// restart the pipestance.  Only failed pipestances can be restarted, and only
+// with an invocation equivalent to the original one, since the outputs of
+// completed stages are reused.
+func (self *mrpWebServer) applyInvocation(w http.ResponseWriter, req *http.Request) {
+	if !self.verifyAuth(w, req) {
+		return
+	}
+	if req.Method != http.MethodPost {
+		http.Error(w, "Expected POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if self.pipestanceBox.readOnly {
+		http.Error(w, "mrp is in read-only mode.", http.StatusBadRequest)
+		return
+	}
+	src, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxInvocationSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	self.pipestanceBox.cleanupLock.Lock()
+	defer self.pipestanceBox.cleanupLock.Unlock()
+	pipestance := self.pipestanceBox.getPipestance()
+	if st := pipestance.GetState(req.Context()); st != core.Failed {
+		http.Error(w, "Only failed pipestances can be restarted.", http.StatusBadRequest)
+		return
+	}
+	result, err := api.ApplyInvocation(pipestance, string(src))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !result.Ok {
+		http.Error(w, result.Error, http.StatusBadRequest)
+		return
+	}
+	util.LogInfo("webserv", "Invocation updated from the web UI.  "+
+		"To restart mrp by hand, use %s as the invocation.",
+		path.Join(pipestance.GetPath(), core.InvocationFile.FileName()))
+	self.pipestanceBox.setInvocation(string(src))
+	if err := self.pipestanceBox.reset(req.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	self.writeGzipJson(w, req, result)
+}
+
+// Serialize an object as json and write it gzip-compressed to the response.
+func (self *mrpWebServer) writeGzipJson(w http.ResponseWriter, req *http.Request,
+	obj interface{}) {
+	bytes, err := json.Marshal(obj)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := req.Context().Err(); err != nil {
+		// Don't sending bytes if the request was canceled.
+		http.Error(w, err.Error(), http.StatusRequestTimeout)
+		return
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Set("Content-Type", "application/json")
+	zipper, _ := gzip.NewWriterLevel(w, gzip.BestSpeed)
+	zipper.Write(bytes)
+	if err := zipper.Close(); err != nil {
+		// Can't use http.Error since the header was already set.
+		fmt.Fprintf(w, "\nzip error: %v", err)
+	}
+}
+
 // Get metadata file contents.
 func (self *mrpWebServer) getMetadata(w http.ResponseWriter, req *http.Request) {
 	// Someone thought it was a good idea to put a JSON object in the body
@@ -412,6 +652,101 @@ func (self *mrpWebServer) listMetadataTop(w http.ResponseWriter, req *http.Reque
 	}
 }
 
+// Returns true if p is a pipestance directory.
+func isPipestanceDir(p string) bool {
+	if info, err := os.Stat(p); err != nil || !info.IsDir() {
+		return false
+	}
+	for _, name := range [...]core.MetadataFileName{
+		core.FinalState,
+		core.InvocationFile,
+	} {
+		if _, err := os.Stat(path.Join(p, name.FileName())); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Reads the final state of the pipestance given by the "other" form value,
+// for comparison against this one.  Because this reads an arbitrary path on
+// the filesystem, it always requires authentication, and only accepts
+// pipestance directories.
+func (self *mrpWebServer) readOtherPipestance(w http.ResponseWriter,
+	req *http.Request) (string, []*core.NodeInfo, bool) {
+	if !self.verifyAuth(w, req) {
+		return "", nil, false
+	}
+	other := req.FormValue("other")
+	if other == "" {
+		http.Error(w, "The path of a pipestance to compare against is required.",
+			http.StatusBadRequest)
+		return "", nil, false
+	}
+	other = path.Clean(other)
+	if !isPipestanceDir(other) {
+		http.Error(w, other+" is not a pipestance directory.",
+			http.StatusBadRequest)
+		return "", nil, false
+	}
+	var otherNodes []*core.NodeInfo
+	if err := self.rt.GetSerializationInto(other, core.FinalState, &otherNodes); err != nil {
+		http.Error(w, "Could not read final state for "+other+": "+err.Error(),
+			http.StatusNotFound)
+		return "", nil, false
+	}
+	return other, otherNodes, true
+}
+
+// Compare this pipestance against another one, given by the "other" form
+// value.
+func (self *mrpWebServer) compare(w http.ResponseWriter, req *http.Request) {
+	other, otherNodes, ok := self.readOtherPipestance(w, req)
+	if !ok {
+		return
+	}
+	var otherPerf []*core.NodePerfInfo
+	if err := self.rt.GetSerializationInto(other, core.Perf, &otherPerf); err != nil {
+		util.LogInfo("webserv", "No performance data for %s: %v", other, err)
+	}
+	pipestance := self.pipestanceBox.getPipestance()
+	self.writeGzipJson(w, req, api.ComparePipestances(
+		pipestance.GetPath(),
+		getFinalState(self.rt, pipestance),
+		getPerf(self.rt, pipestance),
+		other, otherNodes, otherPerf))
+}
+
+// Compare the job environments of this pipestance against another one,
+// given by the "other" form value.
+func (self *mrpWebServer) compareEnvironment(w http.ResponseWriter, req *http.Request) {
+	other, otherNodes, ok := self.readOtherPipestance(w, req)
+	if !ok {
+		return
+	}
+	pipestance := self.pipestanceBox.getPipestance()
+	self.writeGzipJson(w, req, api.CompareEnvironments(
+		pipestance.GetPath(),
+		getFinalState(self.rt, pipestance),
+		other, otherNodes))
+}
+
+// Download a tarball of the pipestance metadata, logs, and errors, suitable
+// for attaching to a support request.
+func (self *mrpWebServer) debugBundle(w http.ResponseWriter, req *http.Request) {
+	if self.readAuth && !self.verifyAuth(w, req) {
+		return
+	}
+	pipestance := self.pipestanceBox.getPipestance()
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(
+		"attachment; filename=\"%s-debug.tar.gz\"", pipestance.GetPsid()))
+	if err := api.WriteDebugBundle(w, pipestance.GetPath(), false); err != nil {
+		// Can't use http.Error since the header was already set.
+		util.LogError(err, "webserv", "Error writing debug bundle.")
+	}
+}
+
 // Restart failed stage.
 func (self *mrpWebServer) restart(w http.ResponseWriter, req *http.Request) {
 	if !self.verifyAuth(w, req) {
@@ -0,0 +1,238 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/martian-lang/martian/martian/core"
+)
+
+// The differences between two pipestances of the same pipeline, for
+// instance before and after a pipeline upgrade.
+type PipestanceComparison struct {
+	// The path of the pipestance being served.
+	Base string `json:"base"`
+
+	// The path of the pipestance it is being compared against.
+	Other string `json:"other"`
+
+	// Nodes which exist in the other pipestance but not this one.
+	Added []string `json:"added"`
+
+	// Nodes which exist in this pipestance but not the other one.
+	Removed []string `json:"removed"`
+
+	// Nodes which exist in both pipestances.
+	Nodes []*NodeComparison `json:"nodes"`
+}
+
+// The differences for a single node which exists in both pipestances.
+type NodeComparison struct {
+	// The node name, with the "ID.<psid>." prefix removed so that it is the
+	// same in both pipestances.
+	Name string `json:"name"`
+	Type string `json:"type"`
+
+	BaseState  core.MetadataState `json:"base_state"`
+	OtherState core.MetadataState `json:"other_state"`
+
+	// Total wall time across all forks, in seconds.
+	BaseWallTime  float64 `json:"base_walltime"`
+	OtherWallTime float64 `json:"other_walltime"`
+
+	// OtherWallTime - BaseWallTime.
+	WallTimeDelta float64 `json:"walltime_delta"`
+
+	// Argument bindings whose values differ between the two pipestances.
+	Params []*ParamComparison `json:"params,omitempty"`
+}
+
+// An argument which differs between two pipestances.
+type ParamComparison struct {
+	// The fork directory name, from the base pipestance if the fork exists
+	// there.
+	Fork  string      `json:"fork"`
+	Id    string      `json:"id"`
+	Base  interface{} `json:"base"`
+	Other interface{} `json:"other"`
+}
+
+// Removes the "ID.<psid>." prefix from a node's fully-qualified name.
+func relativeFqname(fqname string) string {
+	parts := strings.SplitN(fqname, ".", 3)
+	if len(parts) == 3 && parts[0] == "ID" {
+		return parts[2]
+	}
+	return fqname
+}
+
+func indexNodes(nodes []*core.NodeInfo) map[string]*core.NodeInfo {
+	result := make(map[string]*core.NodeInfo, len(nodes))
+	for _, node := range nodes {
+		result[relativeFqname(node.Fqname)] = node
+	}
+	return result
+}
+
+func totalWallTime(nodes []*core.NodePerfInfo) map[string]float64 {
+	result := make(map[string]float64, len(nodes))
+	for _, node := range nodes {
+		var t float64
+		for _, fork := range node.Forks {
+			if fork.ForkStats != nil {
+				t += fork.ForkStats.WallTime
+			}
+		}
+		result[relativeFqname(node.Fqname)] = t
+	}
+	return result
+}
+
+func forkArguments(fork *core.ForkInfo) map[string]interface{} {
+	if fork == nil || fork.Bindings == nil {
+		return nil
+	}
+	result := make(map[string]interface{}, len(fork.Bindings.Argument))
+	for _, binding := range fork.Bindings.Argument {
+		result[binding.Id] = binding.Value
+	}
+	return result
+}
+
+// Compares values by their json serialization, since they may have come
+// from different sources.
+func sameValue(a, b interface{}) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
+
+// Gets a key identifying a fork by its sweep argument values.  Fork indices
+// and directory names are not used, since they change if a sweep is
+// reordered or if only one of the pipestances used --stable-fork-ids.
+func forkKey(fork *core.ForkInfo) string {
+	if len(fork.ArgPermute) == 0 {
+		return ""
+	}
+	if b, err := json.Marshal(fork.ArgPermute); err == nil {
+		return string(b)
+	}
+	return fork.Id
+}
+
+// Pairs up the forks of a node in the two pipestances by their sweep values.
+// Forks which exist in only one of them are paired with nil.
+func pairForks(base, other []*core.ForkInfo) [][2]*core.ForkInfo {
+	otherByKey := make(map[string]*core.ForkInfo, len(other))
+	for _, fork := range other {
+		if fork != nil {
+			otherByKey[forkKey(fork)] = fork
+		}
+	}
+	pairs := make([][2]*core.ForkInfo, 0, len(base))
+	for _, fork := range base {
+		if fork == nil {
+			continue
+		}
+		key := forkKey(fork)
+		pairs = append(pairs, [2]*core.ForkInfo{fork, otherByKey[key]})
+		delete(otherByKey, key)
+	}
+	for _, fork := range other {
+		if fork != nil && otherByKey[forkKey(fork)] == fork {
+			pairs = append(pairs, [2]*core.ForkInfo{nil, fork})
+		}
+	}
+	return pairs
+}
+
+func forkName(fork *core.ForkInfo) string {
+	if fork.Id != "" {
+		return fork.Id
+	}
+	return fmt.Sprintf("fork%d", fork.Index)
+}
+
+func compareParams(base, other *core.NodeInfo) []*ParamComparison {
+	var result []*ParamComparison
+	for _, pair := range pairForks(base.Forks, other.Forks) {
+		baseArgs := forkArguments(pair[0])
+		otherArgs := forkArguments(pair[1])
+		var name string
+		if pair[0] != nil {
+			name = forkName(pair[0])
+		} else {
+			name = forkName(pair[1])
+		}
+		ids := make([]string, 0, len(baseArgs)+len(otherArgs))
+		for id := range baseArgs {
+			ids = append(ids, id)
+		}
+		for id := range otherArgs {
+			if _, ok := baseArgs[id]; !ok {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			bv, otherV := baseArgs[id], otherArgs[id]
+			if !sameValue(bv, otherV) {
+				result = append(result, &ParamComparison{
+					Fork:  name,
+					Id:    id,
+					Base:  bv,
+					Other: otherV,
+				})
+			}
+		}
+	}
+	return result
+}
+
+// Computes the differences between two pipestances, given their serialized
+// state and performance information.
+func ComparePipestances(
+	basePath string, baseNodes []*core.NodeInfo, basePerf []*core.NodePerfInfo,
+	otherPath string, otherNodes []*core.NodeInfo, otherPerf []*core.NodePerfInfo,
+) *PipestanceComparison {
+	result := &PipestanceComparison{
+		Base:    basePath,
+		Other:   otherPath,
+		Added:   []string{},
+		Removed: []string{},
+		Nodes:   []*NodeComparison{},
+	}
+	baseIndex := indexNodes(baseNodes)
+	otherIndex := indexNodes(otherNodes)
+	baseTimes := totalWallTime(basePerf)
+	otherTimes := totalWallTime(otherPerf)
+	for _, node := range baseNodes {
+		name := relativeFqname(node.Fqname)
+		if other := otherIndex[name]; other == nil {
+			result.Removed = append(result.Removed, name)
+		} else {
+			result.Nodes = append(result.Nodes, &NodeComparison{
+				Name:          name,
+				Type:          node.Type,
+				BaseState:     node.State,
+				OtherState:    other.State,
+				BaseWallTime:  baseTimes[name],
+				OtherWallTime: otherTimes[name],
+				WallTimeDelta: otherTimes[name] - baseTimes[name],
+				Params:        compareParams(node, other),
+			})
+		}
+	}
+	for _, node := range otherNodes {
+		if name := relativeFqname(node.Fqname); baseIndex[name] == nil {
+			result.Added = append(result.Added, name)
+		}
+	}
+	return result
+}
@@ -0,0 +1,114 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+
+package api
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/martian-lang/martian/martian/core"
+)
+
+// Files larger than this are left out of debug bundles.
+const debugBundleMaxFileSize = 16 * 1024 * 1024
+
+// Returns true if a file should be included in a debug bundle.  Only
+// metadata files are included, and not the ones which are either
+// profiler output or otherwise likely to be large.  If scrub is true,
+// files which contain pipeline arguments or outputs are also excluded, since
+// they may contain sample names or other identifying information.
+func includeInDebugBundle(info os.FileInfo, scrub bool) bool {
+	name := info.Name()
+	if !info.Mode().IsRegular() ||
+		info.Size() > debugBundleMaxFileSize ||
+		!strings.HasPrefix(name, core.MetadataFilePrefix) {
+		return false
+	}
+	switch core.MetadataFileName(strings.TrimPrefix(name, core.MetadataFilePrefix)) {
+	case core.PerfData, core.ProfileOut, core.Lock, core.UiPort:
+		return false
+	case core.ArgsFile, core.OutsFile, core.ChunkDefsFile, core.ChunkOutsFile,
+		core.StageDefsFile, core.InvocationFile, core.MroSourceFile,
+		core.FinalState, core.JobInfoFile, core.TagsFile, "jobscript":
+		return !scrub
+	default:
+		return true
+	}
+}
+
+// Writes a gzipped tarball containing the metadata, logs, errors, and
+// performance information for the pipestance at psdir.  Stage output
+// files are not included.  If scrub is true, metadata files which may contain
+// identifying information, such as stage arguments, are also left out.
+func WriteDebugBundle(w io.Writer, psdir string, scrub bool) error {
+	zipper, _ := gzip.NewWriterLevel(w, gzip.BestSpeed)
+	tw := tar.NewWriter(zipper)
+	root := filepath.Base(psdir)
+	err := filepath.Walk(psdir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Files may disappear while the pipestance is running.
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			switch info.Name() {
+			case "files", "extras", "journal", "tmp":
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !includeInDebugBundle(info, scrub) {
+			return nil
+		}
+		rel, err := filepath.Rel(psdir, p)
+		if err != nil {
+			return err
+		}
+		return addToDebugBundle(tw, p, filepath.ToSlash(filepath.Join(root, rel)))
+	})
+	if err != nil {
+		tw.Close()
+		zipper.Close()
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		zipper.Close()
+		return err
+	}
+	return zipper.Close()
+}
+
+func addToDebugBundle(tw *tar.Writer, p, name string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	// Stat the open file, in case it changed since the directory walk.
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	// Copy at most the size in the header, since the file may be growing.
+	_, err = io.CopyN(tw, f, hdr.Size)
+	return err
+}
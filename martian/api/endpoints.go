@@ -36,6 +36,51 @@ const (
 	// Get the list of valid top-level metadata files.
 	QueryListMetadataTop = "/api/list-metadata-top"
 
+	// Compares a pipestance against another pipestance of the same pipeline.
+	QueryCompare = "/api/compare"
+
+	// Compares the environments in which the stages of a pipestance and
+	// another pipestance ran.
+	QueryCompareEnvironment = "/api/compare-environment"
+
+	// Downloads a tarball of a pipestance's metadata files, for debugging.
+	QueryDebugBundle = "/api/debug-bundle"
+
+	// Gets the pipeline graph, with node states and edge bindings.
+	QueryGetGraph = "/api/get-graph"
+
+	// Gets job start and end times, for rendering a timeline.
+	QueryGetTimeline = "/api/get-timeline"
+
+	// Gets the distribution of job queue wait times for each stage.
+	QueryGetQueueStats = "/api/get-queue-stats"
+
+	// Gets the sweep values, state, and outputs of each fork of a node,
+	// given by the fqname parameter, or of every node with multiple forks.
+	QueryGetForkSummary = "/api/get-fork-summary"
+
+	// Gets the number of completed stages and the estimated time remaining.
+	QueryGetProgress = "/api/get-progress"
+
+	// Gets the invocation mro source for the pipestance.
+	QueryGetInvocation = "/api/get-invocation"
+
+	// Compiles the mro source in the request body and reports whether it
+	// is a valid invocation, and whether it is equivalent to the invocation
+	// the pipestance was started with.
+	QueryValidateInvocation = "/api/validate-invocation"
+
+	// Replaces the invocation of a failed pipestance with the mro source in
+	// the request body, if it is equivalent to the original invocation, and
+	// restarts the pipestance.
+	QueryApplyInvocation = "/api/apply-invocation"
+
+	// Reports whether the process is alive and able to make progress.
+	QueryHealth = "/healthz"
+
+	// Reports whether the process is ready to serve requests.
+	QueryReady = "/readyz"
+
 	// Gets the content of files in the pipestance extras directory.
 	QueryExtras = "/extras/"
 )
@@ -0,0 +1,140 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/martian-lang/martian/martian/core"
+)
+
+// The differences between the environments in which the stages of two
+// pipestances ran, for debugging results which change when a pipestance
+// is rerun.
+type EnvironmentComparison struct {
+	// The path of the pipestance being served.
+	Base string `json:"base"`
+
+	// The path of the pipestance it is being compared against.
+	Other string `json:"other"`
+
+	Differences []*EnvironmentDifference `json:"differences"`
+}
+
+// A part of the environment which differs for one fork of a stage.
+type EnvironmentDifference struct {
+	// The stage name, with the "ID.<psid>." prefix removed.
+	Stage string `json:"stage"`
+	Fork  int    `json:"fork"`
+
+	// An environment variable name, or one of "modules", "container",
+	// "executable", or "python".
+	Key   string `json:"key"`
+	Base  string `json:"base"`
+	Other string `json:"other"`
+}
+
+// Reads the captured environment of the first job of a fork which has one.
+// Returns nil if no environment was captured, for example if the metadata
+// was zipped or the pipestance was run by an older version of Martian.
+func forkEnvironment(fork *core.ForkInfo) map[string]string {
+	if fork == nil {
+		return nil
+	}
+	var metas []*core.MetadataInfo
+	for _, chunk := range fork.Chunks {
+		metas = append(metas, chunk.Metadata)
+	}
+	metas = append(metas, fork.SplitMetadata, fork.JoinMetadata)
+	for _, meta := range metas {
+		if meta == nil {
+			continue
+		}
+		b, err := ioutil.ReadFile(path.Join(meta.Path, core.JobInfoFile.FileName()))
+		if err != nil {
+			continue
+		}
+		var info core.JobInfo
+		if json.Unmarshal(b, &info) != nil || info.Environment == nil {
+			continue
+		}
+		env := info.Environment
+		result := make(map[string]string, len(env.Vars)+4)
+		for k, v := range env.Vars {
+			result[k] = v
+		}
+		result["modules"] = strings.Join(env.Modules, ":")
+		result["container"] = env.Container
+		result["executable"] = env.Executable
+		if info.PythonInfo != nil {
+			result["python"] = info.PythonInfo.BinPath + " " + info.PythonInfo.Version
+		}
+		return result
+	}
+	return nil
+}
+
+// Computes the differences between the environments captured for the
+// stages of two pipestances, given their serialized final state.  Stages
+// which only exist in one pipestance, or for which no environment was
+// captured in one of them, are skipped.
+func CompareEnvironments(
+	basePath string, baseNodes []*core.NodeInfo,
+	otherPath string, otherNodes []*core.NodeInfo,
+) *EnvironmentComparison {
+	result := &EnvironmentComparison{
+		Base:        basePath,
+		Other:       otherPath,
+		Differences: []*EnvironmentDifference{},
+	}
+	otherIndex := indexNodes(otherNodes)
+	for _, node := range baseNodes {
+		if node.Type != "stage" {
+			continue
+		}
+		name := relativeFqname(node.Fqname)
+		other := otherIndex[name]
+		if other == nil {
+			continue
+		}
+		for i, fork := range node.Forks {
+			if i >= len(other.Forks) {
+				break
+			}
+			baseEnv := forkEnvironment(fork)
+			otherEnv := forkEnvironment(other.Forks[i])
+			if baseEnv == nil || otherEnv == nil {
+				continue
+			}
+			keys := make([]string, 0, len(baseEnv)+len(otherEnv))
+			for k := range baseEnv {
+				keys = append(keys, k)
+			}
+			for k := range otherEnv {
+				if _, ok := baseEnv[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if baseEnv[k] != otherEnv[k] {
+					result.Differences = append(result.Differences,
+						&EnvironmentDifference{
+							Stage: name,
+							Fork:  i,
+							Key:   k,
+							Base:  baseEnv[k],
+							Other: otherEnv[k],
+						})
+				}
+			}
+		}
+	}
+	return result
+}
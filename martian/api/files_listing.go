@@ -18,7 +18,7 @@ type FilesListing struct {
 
 func fileOnWhitelist(f core.MetadataFileName) bool {
 	switch f {
-	case "filelist", "sitecheck",
+	case "crashreport", "filelist", "sitecheck",
 		core.AlarmFile, core.Assert, core.Errors,
 		core.LogFile:
 		return true
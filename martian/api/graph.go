@@ -0,0 +1,104 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+
+package api
+
+import (
+	"sort"
+
+	"github.com/martian-lang/martian/martian/core"
+)
+
+// The resolved pipeline graph, in a form suitable for rendering with
+// generic graph layout tools.
+type PipelineGraph struct {
+	Nodes []*GraphNode `json:"nodes"`
+	Edges []*GraphEdge `json:"edges"`
+}
+
+// A node in the pipeline graph.
+type GraphNode struct {
+	// The fully-qualified name of the node, which is unique.
+	Id    string             `json:"id"`
+	Name  string             `json:"name"`
+	Type  string             `json:"type"`
+	State core.MetadataState `json:"state"`
+
+	ForksTotal     int `json:"forks_total"`
+	ForksComplete  int `json:"forks_complete"`
+	ChunksTotal    int `json:"chunks_total"`
+	ChunksComplete int `json:"chunks_complete"`
+}
+
+// A dependency between two nodes in the pipeline graph.
+type GraphEdge struct {
+	// The fully-qualified names of the upstream and downstream nodes.
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	// The argument bindings of the downstream node which reference the
+	// upstream node.  This may be empty for dependencies which don't
+	// come from an argument binding, such as those from a disabled binding.
+	Bindings []string `json:"bindings"`
+}
+
+func makeGraphNode(node *core.NodeInfo) *GraphNode {
+	gn := &GraphNode{
+		Id:         node.Fqname,
+		Name:       node.Name,
+		Type:       node.Type,
+		State:      node.State,
+		ForksTotal: len(node.Forks),
+	}
+	for _, fork := range node.Forks {
+		if fork.State == core.Complete || fork.State == core.DisabledState {
+			gn.ForksComplete++
+		}
+		gn.ChunksTotal += len(fork.Chunks)
+		for _, chunk := range fork.Chunks {
+			if chunk.State == core.Complete {
+				gn.ChunksComplete++
+			}
+		}
+	}
+	return gn
+}
+
+// Returns the argument ids of a node bound to outputs of the given node name.
+func boundArguments(node *core.NodeInfo, from string) []string {
+	ids := []string{}
+	if len(node.Forks) == 0 || node.Forks[0].Bindings == nil {
+		return ids
+	}
+	for _, binding := range node.Forks[0].Bindings.Argument {
+		if name, ok := binding.Node.(string); ok && name == from {
+			ids = append(ids, binding.Id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Builds the pipeline graph from serialized pipestance state.
+func MakePipelineGraph(nodes []*core.NodeInfo) *PipelineGraph {
+	graph := &PipelineGraph{
+		Nodes: make([]*GraphNode, 0, len(nodes)),
+		Edges: []*GraphEdge{},
+	}
+	names := make(map[string]string, len(nodes))
+	for _, node := range nodes {
+		names[node.Fqname] = node.Name
+	}
+	for _, node := range nodes {
+		graph.Nodes = append(graph.Nodes, makeGraphNode(node))
+		for _, edge := range node.Edges {
+			graph.Edges = append(graph.Edges, &GraphEdge{
+				From:     edge.From,
+				To:       edge.To,
+				Bindings: boundArguments(node, names[edge.From]),
+			})
+		}
+	}
+	return graph
+}
@@ -0,0 +1,74 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+// Health and readiness probes.
+//
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// A function which checks the status of a subsystem, returning nil if the
+// subsystem is healthy.
+type HealthCheck func() error
+
+// The result of running a set of health checks.
+type HealthStatus struct {
+	Ok bool `json:"ok"`
+
+	// The result of each check, either "ok" or an error message.
+	Checks map[string]string `json:"checks"`
+}
+
+func runHealthChecks(checks map[string]HealthCheck) *HealthStatus {
+	status := &HealthStatus{
+		Ok:     true,
+		Checks: make(map[string]string, len(checks)),
+	}
+	for name, check := range checks {
+		if err := check(); err != nil {
+			status.Ok = false
+			status.Checks[name] = err.Error()
+		} else {
+			status.Checks[name] = "ok"
+		}
+	}
+	return status
+}
+
+func serveHealthChecks(checks map[string]HealthCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		status := runHealthChecks(checks)
+		b, err := json.Marshal(status)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		if !status.Ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write(b)
+	}
+}
+
+// Enables the /healthz and /readyz endpoints.  Each responds with status 200
+// if all of its checks pass, or 503 otherwise, along with a json-encoded
+// HealthStatus.  Readiness checks include the health checks as well.
+// These endpoints do not require authentication, so checks should not
+// report sensitive information.
+func EnableHealthChecks(sm *http.ServeMux, health, ready map[string]HealthCheck) {
+	all := make(map[string]HealthCheck, len(health)+len(ready))
+	for name, check := range health {
+		all[name] = check
+	}
+	for name, check := range ready {
+		all[name] = check
+	}
+	sm.HandleFunc(QueryHealth, serveHealthChecks(health))
+	sm.HandleFunc(QueryReady, serveHealthChecks(all))
+}
@@ -0,0 +1,82 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+// Validation and application of edited invocations.
+//
+
+package api
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/martian-lang/martian/martian/core"
+	"github.com/martian-lang/martian/martian/syntax"
+)
+
+// The result of compiling an edited invocation.
+type InvocationValidation struct {
+	Ok    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+
+	// True if the call is equivalent to the one the pipestance was started
+	// with.  Otherwise, the pipestance cannot be restarted with the edited
+	// invocation, and it must be run in a new pipestance directory.
+	Equivalent bool `json:"equivalent"`
+}
+
+// Compiles an edited invocation for a pipestance, using the pipestance's
+// mro path, and checks that it calls a pipeline.
+func ValidateInvocation(pipestance *core.Pipestance, src string) *InvocationValidation {
+	result, _ := validateInvocation(pipestance, src)
+	return result
+}
+
+// Validates an edited invocation, and returns the validation along with
+// the preprocessed source.
+func validateInvocation(pipestance *core.Pipestance,
+	src string) (*InvocationValidation, string) {
+	psPath := pipestance.GetPath()
+	mroPaths := pipestance.GetMroPaths()
+	postsrc, _, ast, err := syntax.ParseSource(src,
+		path.Join(psPath, core.InvocationFile.FileName()), mroPaths, false)
+	if err != nil {
+		return &InvocationValidation{Error: err.Error()}, ""
+	}
+	if ast.Call == nil {
+		return &InvocationValidation{
+			Error: "cannot start a pipeline without a call statement",
+		}, ""
+	}
+	if ast.Callables.Table[ast.Call.DecId] == nil {
+		return &InvocationValidation{
+			Error: fmt.Sprintf("'%s' is not a declared pipeline", ast.Call.DecId),
+		}, ""
+	}
+	result := &InvocationValidation{Ok: true}
+	if _, _, oldAst, err := syntax.Compile(
+		path.Join(psPath, core.MroSourceFile.FileName()),
+		mroPaths, false); err == nil {
+		result.Equivalent = ast.EquivalentCall(oldAst)
+	}
+	return result, postsrc
+}
+
+// Replaces the invocation of a pipestance with an edited one, if it is
+// valid and equivalent to the invocation the pipestance was started with.
+// A non-equivalent invocation is rejected, since stage outputs computed for
+// the original call would be reused when the pipestance is restarted.  The
+// validation is returned in either case.
+func ApplyInvocation(pipestance *core.Pipestance, src string) (*InvocationValidation, error) {
+	result, postsrc := validateInvocation(pipestance, src)
+	if !result.Ok {
+		return result, nil
+	}
+	if !result.Equivalent {
+		result.Ok = false
+		result.Error = "the edited call is not equivalent to the original, " +
+			"so it must be run in a new pipestance directory"
+		return result, nil
+	}
+	return result, pipestance.UpdateInvocation(src, postsrc)
+}
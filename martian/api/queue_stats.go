@@ -0,0 +1,99 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+
+package api
+
+import (
+	"sort"
+
+	"github.com/martian-lang/martian/martian/core"
+)
+
+// The distribution of queue wait times for the jobs of a stage.  Times are
+// in seconds.
+type QueueWaitStats struct {
+	Fqname string `json:"fqname"`
+
+	// One of "split", "chunk", or "join".
+	Phase string `json:"phase"`
+
+	Jobs    int `json:"jobs"`
+	Retries int `json:"submit_retries"`
+
+	// Time spent waiting in the cluster or local job manager queue.
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	P90    float64 `json:"p90"`
+	Max    float64 `json:"max"`
+
+	// The longest time mrp held a job before submitting it, for example
+	// because of the --maxjobs or --jobinterval limits.
+	MaxSubmitDelay float64 `json:"max_submit_delay"`
+}
+
+// Returns the value at quantile q of sorted values.
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(q*float64(len(sorted)-1)+0.5)]
+}
+
+func makeQueueWaitStats(fqname, phase string, stats []*core.PerfInfo) *QueueWaitStats {
+	result := &QueueWaitStats{
+		Fqname: fqname,
+		Phase:  phase,
+	}
+	waits := make([]float64, 0, len(stats))
+	for _, s := range stats {
+		if s == nil || s.Start.IsZero() {
+			continue
+		}
+		waits = append(waits, s.QueueWait)
+		result.Retries += s.SubmitRetries
+		result.Mean += s.QueueWait
+		if s.SubmitDelay > result.MaxSubmitDelay {
+			result.MaxSubmitDelay = s.SubmitDelay
+		}
+	}
+	if len(waits) == 0 {
+		return nil
+	}
+	sort.Float64s(waits)
+	result.Jobs = len(waits)
+	result.Mean /= float64(len(waits))
+	result.Median = quantile(waits, 0.5)
+	result.P90 = quantile(waits, 0.9)
+	result.Max = waits[len(waits)-1]
+	return result
+}
+
+// Computes the distribution of queue wait times for each stage and phase in
+// the pipestance, across all forks.
+func MakeQueueStats(perf []*core.NodePerfInfo) []*QueueWaitStats {
+	result := make([]*QueueWaitStats, 0, len(perf))
+	for _, node := range perf {
+		if node.Type != "stage" {
+			continue
+		}
+		var splits, chunks, joins []*core.PerfInfo
+		for _, fork := range node.Forks {
+			splits = append(splits, fork.SplitStats)
+			for _, chunk := range fork.Chunks {
+				chunks = append(chunks, chunk.ChunkStats)
+			}
+			joins = append(joins, fork.JoinStats)
+		}
+		for _, s := range [...]*QueueWaitStats{
+			makeQueueWaitStats(node.Fqname, "split", splits),
+			makeQueueWaitStats(node.Fqname, "chunk", chunks),
+			makeQueueWaitStats(node.Fqname, "join", joins),
+		} {
+			if s != nil {
+				result = append(result, s)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,179 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/martian-lang/martian/martian/core"
+)
+
+// Runs a pipestance in the current process, for services which want to
+// orchestrate pipelines without running mrp.  The runtime used to create the
+// factory must be the one passed to NewPipestanceRunner.
+//
+// Unlike mrp, the runner does not serve a UI, handle signals, or exit the
+// process when the pipestance completes.
+type PipestanceRunner struct {
+	rt      *core.Runtime
+	factory core.PipestanceFactory
+
+	// The number of times to automatically restart the pipestance after a
+	// transient failure.
+	Retries int
+
+	// How long Run waits between steps when nothing changed.
+	StepInterval time.Duration
+
+	lock       sync.Mutex
+	pipestance *core.Pipestance
+	retries    int
+}
+
+func NewPipestanceRunner(rt *core.Runtime, factory core.PipestanceFactory) *PipestanceRunner {
+	return &PipestanceRunner{
+		rt:           rt,
+		factory:      factory,
+		Retries:      core.DefaultRetries(),
+		StepInterval: 3 * time.Second,
+	}
+}
+
+// Invokes the pipestance, or reattaches to it if it already exists.
+func (self *PipestanceRunner) Start(ctx context.Context) error {
+	ps, err := self.factory.InvokePipeline()
+	if _, ok := err.(*core.PipestanceExistsError); ok {
+		ps, err = self.factory.ReattachToPipestance(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	ps.LoadMetadata(ctx)
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.pipestance = ps
+	self.retries = self.Retries
+	return nil
+}
+
+// Gets the current pipestance object.  This changes when the pipestance is
+// restarted.
+func (self *PipestanceRunner) Pipestance() *core.Pipestance {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.pipestance
+}
+
+// Gets the current state of the pipestance.
+func (self *PipestanceRunner) State(ctx context.Context) core.MetadataState {
+	return self.Pipestance().GetState(ctx)
+}
+
+// Gets the serialized state of all of the nodes in the pipestance.
+func (self *PipestanceRunner) Nodes() []*core.NodeInfo {
+	return self.Pipestance().SerializeState()
+}
+
+// Refreshes the pipestance state and, if it is still running, checks
+// heartbeats and starts any jobs which are ready.  Returns the pipestance
+// state and whether anything changed.
+func (self *PipestanceRunner) Step(ctx context.Context) (core.MetadataState, bool) {
+	ps := self.Pipestance()
+	ps.RefreshState(ctx)
+	state := ps.GetState(ctx)
+	switch state {
+	case core.Complete, core.DisabledState, core.Failed:
+		return state, false
+	}
+	ps.CheckHeartbeats(ctx)
+	return state, ps.StepNodes(ctx)
+}
+
+// Resets failed stages and reattaches to the pipestance.
+func (self *PipestanceRunner) Restart(ctx context.Context) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.pipestance != nil {
+		self.pipestance.Unlock()
+	}
+	ps, err := self.factory.ReattachToPipestance(ctx)
+	if err != nil {
+		return err
+	}
+	if err := ps.Reset(); err != nil {
+		ps.Unlock()
+		return err
+	}
+	ps.LoadMetadata(ctx)
+	self.pipestance = ps
+	return nil
+}
+
+// Kills the pipestance's running jobs and releases its lock.
+func (self *PipestanceRunner) Kill(message string) {
+	ps := self.Pipestance()
+	ps.KillWithMessage(message)
+	ps.Unlock()
+}
+
+// Steps the pipestance until it completes or fails, or ctx is canceled.
+// Transient failures are retried up to Retries times.  When the pipestance
+// completes, its outputs are post-processed and its lock released.
+func (self *PipestanceRunner) Run(ctx context.Context) (core.MetadataState, error) {
+	t := time.NewTimer(0)
+	if !t.Stop() {
+		<-t.C
+	}
+	for {
+		state, progress := self.Step(ctx)
+		switch state {
+		case core.Complete, core.DisabledState:
+			ps := self.Pipestance()
+			if self.rt.Config.VdrMode != "disable" {
+				ps.VDRKill()
+			}
+			ps.PostProcess()
+			ps.Unlock()
+			return state, nil
+		case core.Failed:
+			if self.retry(ctx) {
+				continue
+			}
+			ps := self.Pipestance()
+			ps.Unlock()
+			fqname, _, summary, _, _, _ := ps.GetFatalError()
+			return state, fmt.Errorf("%s failed: %s", fqname, summary)
+		}
+		if !progress {
+			t.Reset(self.StepInterval)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				if !t.Stop() {
+					<-t.C
+				}
+				return state, ctx.Err()
+			}
+		}
+	}
+}
+
+// Restarts the pipestance if the failure was transient and retries remain.
+func (self *PipestanceRunner) retry(ctx context.Context) bool {
+	self.lock.Lock()
+	if self.retries <= 0 {
+		self.lock.Unlock()
+		return false
+	}
+	self.retries--
+	self.lock.Unlock()
+	if ok, _ := self.Pipestance().IsErrorTransient(); !ok {
+		return false
+	}
+	return self.Restart(ctx) == nil
+}
@@ -0,0 +1,141 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+
+package api
+
+import (
+	"sort"
+	"time"
+
+	"github.com/martian-lang/martian/martian/core"
+)
+
+// Timing information for the jobs in a pipestance, suitable for rendering
+// as a Gantt chart.
+type Timeline struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// Jobs, sorted by start time.
+	Jobs []*TimelineJob `json:"jobs"`
+
+	// The fully-qualified names of the chain of stages which determined the
+	// completion time of the pipestance, starting from the earliest.
+	CriticalPath []string `json:"critical_path"`
+}
+
+// Timing information for a single split, chunk, or join job.
+type TimelineJob struct {
+	Fqname string `json:"fqname"`
+	Fork   int    `json:"fork"`
+
+	// One of "split", "chunk", or "join".
+	Phase string `json:"phase"`
+	Chunk int    `json:"chunk,omitempty"`
+
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// Seconds between when the job was submitted and when it started.
+	QueueWait float64 `json:"queue_wait"`
+}
+
+func appendTimelineJob(jobs []*TimelineJob, fqname string, fork int,
+	phase string, chunk int, stats *core.PerfInfo) []*TimelineJob {
+	if stats == nil || stats.Start.IsZero() {
+		return jobs
+	}
+	return append(jobs, &TimelineJob{
+		Fqname:    fqname,
+		Fork:      fork,
+		Phase:     phase,
+		Chunk:     chunk,
+		Start:     stats.Start,
+		End:       stats.End,
+		QueueWait: stats.QueueWait,
+	})
+}
+
+// Walks backwards from the given node, at each step following the upstream
+// dependency which finished last.
+func criticalPath(nodes []*core.NodeInfo, ends map[string]time.Time,
+	last string) []string {
+	preds := make(map[string][]string, len(nodes))
+	for _, node := range nodes {
+		for _, edge := range node.Edges {
+			preds[edge.To] = append(preds[edge.To], edge.From)
+		}
+	}
+	path := []string{}
+	seen := make(map[string]bool)
+	for last != "" && !seen[last] {
+		seen[last] = true
+		path = append(path, last)
+		next := ""
+		var nextEnd time.Time
+		for _, pred := range preds[last] {
+			if end, ok := ends[pred]; ok && end.After(nextEnd) {
+				next, nextEnd = pred, end
+			}
+		}
+		last = next
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// Builds a timeline from serialized pipestance state and performance
+// information.
+func MakeTimeline(nodes []*core.NodeInfo, perf []*core.NodePerfInfo) *Timeline {
+	timeline := &Timeline{
+		Jobs: []*TimelineJob{},
+	}
+	ends := make(map[string]time.Time)
+	for _, node := range perf {
+		if node.Type != "stage" {
+			// Pipelines don't have jobs of their own, but may still be on
+			// the critical path.
+			for _, fork := range node.Forks {
+				if fork.ForkStats != nil && fork.ForkStats.End.After(ends[node.Fqname]) {
+					ends[node.Fqname] = fork.ForkStats.End
+				}
+			}
+			continue
+		}
+		for _, fork := range node.Forks {
+			timeline.Jobs = appendTimelineJob(timeline.Jobs,
+				node.Fqname, fork.Index, "split", 0, fork.SplitStats)
+			for _, chunk := range fork.Chunks {
+				timeline.Jobs = appendTimelineJob(timeline.Jobs,
+					node.Fqname, fork.Index, "chunk", chunk.Index, chunk.ChunkStats)
+			}
+			timeline.Jobs = appendTimelineJob(timeline.Jobs,
+				node.Fqname, fork.Index, "join", 0, fork.JoinStats)
+		}
+	}
+	for _, job := range timeline.Jobs {
+		if timeline.Start.IsZero() || job.Start.Before(timeline.Start) {
+			timeline.Start = job.Start
+		}
+		if job.End.After(timeline.End) {
+			timeline.End = job.End
+		}
+		if job.End.After(ends[job.Fqname]) {
+			ends[job.Fqname] = job.End
+		}
+	}
+	sort.SliceStable(timeline.Jobs, func(i, j int) bool {
+		return timeline.Jobs[i].Start.Before(timeline.Jobs[j].Start)
+	})
+	var last string
+	for _, job := range timeline.Jobs {
+		if !job.End.Before(timeline.End) {
+			last = job.Fqname
+		}
+	}
+	timeline.CriticalPath = criticalPath(nodes, ends, last)
+	return timeline
+}
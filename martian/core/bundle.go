@@ -0,0 +1,294 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+// Signed pipeline bundles.
+//
+// A bundle is a pipeline directory, normally the parent of an MROPATH
+// directory, containing the mro sources and stage code, along with a
+// manifest of the sha256 checksums of every file in it and an ed25519
+// signature of that manifest.  Bundles are created with mrbundle, and may
+// be archived with tar for distribution.  When given a public key, mrp
+// refuses to run pipelines from MROPATH directories which are not in a
+// bundle signed with that key, and records the manifest checksum in the
+// pipestance so that the exact pipeline code which ran can be proven later.
+//
+// Byte-compiled python files are not included in the manifest, since the
+// interpreter may write them while the pipeline runs.
+//
+
+package core
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+const (
+	// The names of the manifest and signature files in a bundle.
+	BundleManifestFile  = "bundle.json"
+	BundleSignatureFile = "bundle.sig"
+
+	// The prefix for checksums of symbolic links, which record the link
+	// target rather than the content.
+	bundleLinkPrefix = "symlink:"
+)
+
+// The manifest of a pipeline bundle.
+type BundleManifest struct {
+	// The pipeline version, as would be reported for MROPATH.
+	Version string `json:"version,omitempty"`
+	Created string `json:"created"`
+
+	// The sha256 checksums of files, keyed by slash-separated path
+	// relative to the bundle root.
+	Files map[string]string `json:"files"`
+}
+
+// The record of a verified bundle, written to the pipestance metadata.
+type BundleInfo struct {
+	Path    string `json:"path"`
+	Version string `json:"version,omitempty"`
+
+	// The sha256 checksum of the manifest file.
+	Manifest string `json:"manifest_sha256"`
+
+	// The base64-encoded public key which verified the signature.
+	Key string `json:"key"`
+}
+
+// Returns true for files which are not part of the bundle manifest.
+func bundleIgnored(rel string, info os.FileInfo) bool {
+	name := info.Name()
+	if info.IsDir() {
+		return name == ".git" || name == "__pycache__"
+	}
+	return rel == BundleManifestFile || rel == BundleSignatureFile ||
+		strings.HasSuffix(name, ".pyc") || strings.HasSuffix(name, ".pyo")
+}
+
+func fileChecksum(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// Computes the checksums of the files in a bundle directory.
+func bundleChecksums(root string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		if bundleIgnored(rel, info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			files[rel] = bundleLinkPrefix + target
+		case info.Mode().IsRegular():
+			sum, err := fileChecksum(p)
+			if err != nil {
+				return err
+			}
+			files[rel] = sum
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Returns true if the symbolic link at rel, relative to the bundle root,
+// points outside of the bundle.  Absolute targets are always treated as
+// outside, since the bundle may be moved.
+func bundleLinkEscapes(rel, target string) bool {
+	if filepath.IsAbs(target) {
+		return true
+	}
+	p := filepath.Join(filepath.Dir(filepath.FromSlash(rel)), target)
+	return p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator))
+}
+
+// Generates a new key pair for signing bundles.  The keys are returned
+// base64-encoded, as they are stored in key files.
+func GenerateBundleKey() (public, private string, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(pub),
+		base64.StdEncoding.EncodeToString(priv), nil
+}
+
+func readBundleKey(p string, size int) ([]byte, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(b)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key in %s: %v", p, err)
+	}
+	if len(key) != size {
+		return nil, fmt.Errorf("invalid key in %s: expected %d bytes, got %d",
+			p, size, len(key))
+	}
+	return key, nil
+}
+
+// Reads a base64-encoded public key for verifying bundles.
+func ReadBundlePublicKey(p string) (ed25519.PublicKey, error) {
+	key, err := readBundleKey(p, ed25519.PublicKeySize)
+	return ed25519.PublicKey(key), err
+}
+
+// Reads a base64-encoded private key for signing bundles.
+func ReadBundlePrivateKey(p string) (ed25519.PrivateKey, error) {
+	key, err := readBundleKey(p, ed25519.PrivateKeySize)
+	return ed25519.PrivateKey(key), err
+}
+
+// Writes the manifest and signature for the bundle rooted at root.
+func SignBundle(root string, key ed25519.PrivateKey) (*BundleManifest, error) {
+	files, err := bundleChecksums(root)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &BundleManifest{
+		Created: util.Timestamp(),
+		Files:   files,
+	}
+	if v, err := util.GetMroVersion([]string{filepath.Join(root, "mro")}); err == nil {
+		manifest.Version = v
+	}
+	b, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, BundleManifestFile), b, 0644); err != nil {
+		return nil, err
+	}
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, b))
+	return manifest, ioutil.WriteFile(
+		filepath.Join(root, BundleSignatureFile), []byte(sig+"\n"), 0644)
+}
+
+// Verifies the signature of the bundle rooted at root, and that its content
+// matches the manifest.
+func VerifyBundle(root string, key ed25519.PublicKey) (*BundleInfo, error) {
+	b, err := ioutil.ReadFile(filepath.Join(root, BundleManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	sigText, err := ioutil.ReadFile(filepath.Join(root, BundleSignatureFile))
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sigText)))
+	if err != nil || !ed25519.Verify(key, b, sig) {
+		return nil, fmt.Errorf("invalid signature for bundle %s", root)
+	}
+	var manifest BundleManifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return nil, err
+	}
+	files, err := bundleChecksums(root)
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	for name, sum := range files {
+		if target := strings.TrimPrefix(sum, bundleLinkPrefix); target != sum &&
+			bundleLinkEscapes(name, target) {
+			problems = append(problems, name+" links outside the bundle")
+		}
+		if expect, ok := manifest.Files[name]; !ok {
+			problems = append(problems, name+" is not in the manifest")
+		} else if expect != sum {
+			problems = append(problems, name+" was modified")
+		}
+	}
+	for name := range manifest.Files {
+		if _, ok := files[name]; !ok {
+			problems = append(problems, name+" is missing")
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("bundle %s does not match its manifest: %s",
+			root, strings.Join(problems, ", "))
+	}
+	return &BundleInfo{
+		Path:     root,
+		Version:  manifest.Version,
+		Manifest: fmt.Sprintf("%x", sha256.Sum256(b)),
+		Key:      base64.StdEncoding.EncodeToString(key),
+	}, nil
+}
+
+// Finds the bundle containing an MROPATH directory, which is either the
+// directory itself or its parent.
+func findBundleRoot(dir string) (string, error) {
+	for _, root := range [...]string{dir, filepath.Dir(dir)} {
+		if _, err := os.Stat(filepath.Join(root, BundleManifestFile)); err == nil {
+			return root, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not in a signed pipeline bundle", dir)
+}
+
+// Verifies the bundles containing each of the given MROPATH directories.
+func verifyMroPathBundles(mroPaths []string, key ed25519.PublicKey) ([]*BundleInfo, error) {
+	var result []*BundleInfo
+	seen := make(map[string]bool, len(mroPaths))
+	for _, dir := range mroPaths {
+		root, err := findBundleRoot(dir)
+		if err != nil {
+			return nil, err
+		}
+		if seen[root] {
+			continue
+		}
+		seen[root] = true
+		info, err := VerifyBundle(root, key)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, info)
+	}
+	return result, nil
+}
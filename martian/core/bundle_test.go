@@ -0,0 +1,104 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+
+package core
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSignBundle(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestSignBundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	mro := filepath.Join(root, "mro")
+	stages := filepath.Join(root, "lib", "python", "stages")
+	for _, dir := range []string{mro, stages, filepath.Join(stages, "__pycache__")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile := func(p, content string) {
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(filepath.Join(mro, "pipeline.mro"), "pipeline P() {\n}\n")
+	writeFile(filepath.Join(stages, "__init__.py"), "def main(args, outs):\n    pass\n")
+	writeFile(filepath.Join(root, ".version"), "v1.0.0\n")
+
+	public, private, err := GenerateBundleKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubBytes, _ := base64.StdEncoding.DecodeString(public)
+	privBytes, _ := base64.StdEncoding.DecodeString(private)
+	pub, priv := ed25519.PublicKey(pubBytes), ed25519.PrivateKey(privBytes)
+
+	manifest, err := SignBundle(root, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Files) != 3 || manifest.Version != "v1.0.0" {
+		t.Errorf("Incorrect manifest %v", manifest)
+	}
+	infos, err := verifyMroPathBundles([]string{mro}, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Path != root {
+		t.Errorf("Incorrect bundle info %v", infos)
+	}
+
+	// Byte-compiled files may be written while the pipeline runs.
+	writeFile(filepath.Join(stages, "__pycache__", "__init__.pyc"), "x")
+	if _, err := VerifyBundle(root, pub); err != nil {
+		t.Error(err)
+	}
+
+	otherPub, _, _ := ed25519.GenerateKey(nil)
+	if _, err := VerifyBundle(root, otherPub); err == nil {
+		t.Error("Expected verification with the wrong key to fail.")
+	}
+	writeFile(filepath.Join(stages, "extra.py"), "")
+	if _, err := VerifyBundle(root, pub); err == nil {
+		t.Error("Expected verification with an added file to fail.")
+	}
+	os.Remove(filepath.Join(stages, "extra.py"))
+	writeFile(filepath.Join(mro, "pipeline.mro"), "pipeline Q() {\n}\n")
+	if _, err := VerifyBundle(root, pub); err == nil {
+		t.Error("Expected verification with a modified file to fail.")
+	}
+
+	// Symbolic links may point within the bundle, but not outside it.
+	if err := os.Symlink("../../../mro", filepath.Join(stages, "mro")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SignBundle(root, priv); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyBundle(root, pub); err != nil {
+		t.Error(err)
+	}
+	for _, target := range []string{"../../../..", "/etc"} {
+		link := filepath.Join(stages, "outside")
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := SignBundle(root, priv); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := VerifyBundle(root, pub); err == nil {
+			t.Errorf("Expected verification with a link to %s to fail.", target)
+		}
+		os.Remove(link)
+	}
+}
@@ -0,0 +1,15 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+// +build !linux
+
+package core
+
+// Returns 0, as cgroup CPU quotas are only supported on Linux.
+func GetCPUQuota() float64 {
+	return 0
+}
+
+func availableCPUs(numCPU int) int {
+	return numCPU
+}
@@ -0,0 +1,69 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+// Detection of cgroup CPU quotas, which limit the cores available to
+// processes in containers without changing the cpus reported by the kernel.
+//
+
+package core
+
+import (
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Returns the number of cores allowed by the CPU bandwidth quota of the
+// cgroup for this process, or 0 if there is no quota.  Both cgroup v2 and
+// the v1 cpu controller are checked.  Inside a container, the container's
+// own cgroup is mounted at the root of the cgroup filesystem.
+func GetCPUQuota() float64 {
+	if b, err := ioutil.ReadFile("/sys/fs/cgroup/cpu.max"); err == nil {
+		// cgroup v2: "$MAX $PERIOD", where $MAX may be "max".
+		if fields := strings.Fields(string(b)); len(fields) == 2 {
+			return parseCPUQuota(fields[0], fields[1])
+		}
+		return 0
+	}
+	for _, dir := range []string{
+		"/sys/fs/cgroup/cpu",
+		"/sys/fs/cgroup/cpu,cpuacct",
+	} {
+		quota, err := ioutil.ReadFile(dir + "/cpu.cfs_quota_us")
+		if err != nil {
+			continue
+		}
+		period, err := ioutil.ReadFile(dir + "/cpu.cfs_period_us")
+		if err != nil {
+			continue
+		}
+		return parseCPUQuota(strings.TrimSpace(string(quota)),
+			strings.TrimSpace(string(period)))
+	}
+	return 0
+}
+
+func parseCPUQuota(quota, period string) float64 {
+	q, err := strconv.ParseInt(quota, 10, 64)
+	if err != nil || q <= 0 {
+		return 0
+	}
+	p, err := strconv.ParseInt(period, 10, 64)
+	if err != nil || p <= 0 {
+		return 0
+	}
+	return float64(q) / float64(p)
+}
+
+// Returns the number of cores available to this process, taking into
+// account both the CPU affinity mask and any cgroup CPU quota.  Fractional
+// quotas are rounded up.
+func availableCPUs(numCPU int) int {
+	if quota := GetCPUQuota(); quota > 0 {
+		if q := int(math.Ceil(quota)); q < numCPU {
+			return q
+		}
+	}
+	return numCPU
+}
@@ -0,0 +1,24 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+
+package core
+
+import (
+	"testing"
+)
+
+func TestParseCPUQuota(t *testing.T) {
+	check := func(quota, period string, expect float64) {
+		t.Helper()
+		if q := parseCPUQuota(quota, period); q != expect {
+			t.Errorf("Expected %s/%s to give %g cores, got %g",
+				quota, period, expect, q)
+		}
+	}
+	check("max", "100000", 0)
+	check("-1", "100000", 0)
+	check("200000", "100000", 2)
+	check("150000", "100000", 1.5)
+	check("100000", "0", 0)
+}
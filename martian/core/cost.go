@@ -0,0 +1,121 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+// Estimated cost accounting for pipestances.
+//
+// A price table file might look like:
+// {
+//     "currency": "USD",
+//     "core_hour": 0.04,
+//     "mem_gb_hour": 0.005,
+//     "storage_gb_month": 0.023,
+//     "storage_months": 12
+// }
+//
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// Prices used to estimate the cost of a pipestance, either amortized
+// on-premises costs or cloud rates.
+type PriceTable struct {
+	Currency string `json:"currency,omitempty"`
+
+	// The price of one core reserved for one hour.
+	CoreHour float64 `json:"core_hour"`
+
+	// The price of one GB of memory reserved for one hour.
+	MemGBHour float64 `json:"mem_gb_hour"`
+
+	// The price of storing one GB of output for one month.
+	StorageGBMonth float64 `json:"storage_gb_month"`
+
+	// The number of months outputs are expected to be retained.  Defaults
+	// to 1.
+	StorageMonths float64 `json:"storage_months,omitempty"`
+}
+
+// The estimated cost of a pipestance or node.
+type CostEstimate struct {
+	Currency   string  `json:"currency,omitempty"`
+	CoreHours  float64 `json:"core_hours"`
+	MemGBHours float64 `json:"mem_gb_hours"`
+	StorageGB  float64 `json:"storage_gb"`
+	Compute    float64 `json:"compute"`
+	Memory     float64 `json:"memory"`
+	Storage    float64 `json:"storage"`
+	Total      float64 `json:"total"`
+}
+
+// Read a price table file.
+func ReadPriceTable(path string) (*PriceTable, error) {
+	fdata, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var prices PriceTable
+	if err := json.Unmarshal(fdata, &prices); err != nil {
+		return nil, err
+	}
+	if prices.CoreHour < 0 || prices.MemGBHour < 0 ||
+		prices.StorageGBMonth < 0 || prices.StorageMonths < 0 {
+		return nil, fmt.Errorf("negative price in %s", path)
+	}
+	if prices.StorageMonths == 0 {
+		prices.StorageMonths = 1
+	}
+	return &prices, nil
+}
+
+// Estimate the cost of the resources recorded in perf.  Compute and memory
+// are charged for the resources reserved by each job for its duration, and
+// storage for the outputs which remain after volatile data removal.
+func (self *PriceTable) Estimate(perf *PerfInfo) *CostEstimate {
+	if self == nil || perf == nil {
+		return nil
+	}
+	cost := &CostEstimate{
+		Currency:   self.Currency,
+		CoreHours:  perf.CoreHours,
+		MemGBHours: perf.MemGBHours,
+		StorageGB:  float64(perf.OutputBytes) / (1024 * 1024 * 1024),
+	}
+	cost.Compute = cost.CoreHours * self.CoreHour
+	cost.Memory = cost.MemGBHours * self.MemGBHour
+	months := self.StorageMonths
+	if months == 0 {
+		months = 1
+	}
+	cost.Storage = cost.StorageGB * self.StorageGBMonth * months
+	cost.Total = cost.Compute + cost.Memory + cost.Storage
+	return cost
+}
+
+func (self *CostEstimate) add(other *CostEstimate) {
+	self.CoreHours += other.CoreHours
+	self.MemGBHours += other.MemGBHours
+	self.StorageGB += other.StorageGB
+	self.Compute += other.Compute
+	self.Memory += other.Memory
+	self.Storage += other.Storage
+	self.Total += other.Total
+}
+
+// Estimate the cost of a node, summed over all of its forks.
+func (self *PriceTable) estimateNode(perf *NodePerfInfo) *CostEstimate {
+	if self == nil || perf == nil {
+		return nil
+	}
+	cost := &CostEstimate{Currency: self.Currency}
+	for _, fork := range perf.Forks {
+		if c := self.Estimate(fork.ForkStats); c != nil {
+			cost.add(c)
+		}
+	}
+	return cost
+}
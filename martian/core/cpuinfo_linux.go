@@ -62,7 +62,11 @@ func GetCPUInfo() (int, int, int, int) {
 		}
 	}
 
-	if sockets > -1 && physicalCoresPerSocket > -1 && logicalCores > -1 {
+	if logicalCores > -1 && sockets == -1 && physicalCoresPerSocket == -1 {
+		// On arm64, /proc/cpuinfo lists processors without any
+		// topology information.
+		return 1, logicalCores + 1, logicalCores + 1, logicalCores + 1
+	} else if sockets > -1 && physicalCoresPerSocket > -1 && logicalCores > -1 {
 		sockets += 1
 		physicalCoresPerSocket += 1
 		physicalCores := sockets * physicalCoresPerSocket
@@ -0,0 +1,85 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+// Capture of the environment in which jobs run, for reproducibility.
+//
+
+package core
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Environment variables which commonly change the behavior of stage code.
+var capturedEnvs = [...]string{
+	"PATH",
+	"LD_LIBRARY_PATH",
+	"LD_PRELOAD",
+	"PYTHONPATH",
+	"PYTHONHOME",
+	"PYTHONUSERBASE",
+	"CONDA_PREFIX",
+	"VIRTUAL_ENV",
+	"R_HOME",
+	"R_LIBS",
+	"R_LIBS_USER",
+	"JAVA_HOME",
+	"PERL5LIB",
+	"LANG",
+	"LC_ALL",
+	"MROPATH",
+}
+
+// The resolved environment of a job, recorded in its jobinfo.
+type JobEnvironment struct {
+	// Selected environment variables.
+	Vars map[string]string `json:"vars,omitempty"`
+
+	// Environment modules loaded with module load.
+	Modules []string `json:"modules,omitempty"`
+
+	// The image the job ran in, if any.  Job templates which run jobs in
+	// containers can set MARTIAN_CONTAINER_DIGEST to record the image
+	// digest.  Otherwise the singularity or apptainer image path is used.
+	Container string `json:"container,omitempty"`
+
+	// The resolved path to the executable run by the job.
+	Executable string `json:"executable,omitempty"`
+}
+
+// Captures the environment of the current process, which is about to run
+// the given executable.
+func CaptureJobEnvironment(exe string) *JobEnvironment {
+	env := &JobEnvironment{
+		Vars: make(map[string]string, len(capturedEnvs)),
+	}
+	for _, key := range capturedEnvs {
+		if v, ok := os.LookupEnv(key); ok {
+			env.Vars[key] = v
+		}
+	}
+	if mods := os.Getenv("LOADEDMODULES"); mods != "" {
+		env.Modules = strings.Split(mods, ":")
+	}
+	for _, key := range [...]string{
+		"MARTIAN_CONTAINER_DIGEST",
+		"SINGULARITY_CONTAINER",
+		"APPTAINER_CONTAINER",
+	} {
+		if v := os.Getenv(key); v != "" {
+			env.Container = v
+			break
+		}
+	}
+	if p, err := exec.LookPath(exe); err == nil {
+		if p, err := filepath.EvalSymlinks(p); err == nil {
+			env.Executable = p
+		} else {
+			env.Executable = exe
+		}
+	}
+	return env
+}
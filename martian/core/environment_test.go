@@ -0,0 +1,59 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+
+package core
+
+import (
+	"os"
+	"testing"
+)
+
+// Sets environment variables for the duration of a test, returning a
+// function which restores their previous values.
+func setTestEnv(vars map[string]string) func() {
+	type oldValue struct {
+		value string
+		ok    bool
+	}
+	old := make(map[string]oldValue, len(vars))
+	for key, value := range vars {
+		v, ok := os.LookupEnv(key)
+		old[key] = oldValue{v, ok}
+		os.Setenv(key, value)
+	}
+	return func() {
+		for key, v := range old {
+			if v.ok {
+				os.Setenv(key, v.value)
+			} else {
+				os.Unsetenv(key)
+			}
+		}
+	}
+}
+
+func TestCaptureJobEnvironment(t *testing.T) {
+	defer setTestEnv(map[string]string{
+		"PYTHONPATH":               "/opt/lib/python",
+		"LOADEDMODULES":            "gcc/7.2:samtools/1.6",
+		"MARTIAN_CONTAINER_DIGEST": "sha256:0123",
+		"UNRELATED_VARIABLE":       "x",
+	})()
+	env := CaptureJobEnvironment("sh")
+	if env.Vars["PYTHONPATH"] != "/opt/lib/python" {
+		t.Errorf("Expected PYTHONPATH to be captured, got %v", env.Vars)
+	}
+	if _, ok := env.Vars["UNRELATED_VARIABLE"]; ok {
+		t.Error("Unexpected variable captured.")
+	}
+	if len(env.Modules) != 2 || env.Modules[1] != "samtools/1.6" {
+		t.Errorf("Incorrect modules %v", env.Modules)
+	}
+	if env.Container != "sha256:0123" {
+		t.Errorf("Incorrect container %q", env.Container)
+	}
+	if env.Executable == "" {
+		t.Error("Executable was not resolved.")
+	}
+}
@@ -49,14 +49,35 @@ func (self *PipestanceJobModeError) Error() string {
 	return fmt.Sprintf("RuntimeError: pipestance '%s' was originally started in job mode '%s'. Please try running again in job mode '%s'.", self.Psid, self.JobMode, self.JobMode)
 }
 
+// PipelineVersionError
+type PipelineVersionError struct {
+	Pinned string
+	Found  string
+}
+
+func (self *PipelineVersionError) Error() string {
+	return fmt.Sprintf("RuntimeError: the invocation requires pipeline version %s, but the pipelines in MROPATH are version %s. Please set MROPATH to the pinned version of the pipelines, or remove the @mro_version line from the invocation.", self.Pinned, self.Found)
+}
+
 // PipestanceLockedError
 type PipestanceLockedError struct {
 	Psid           string
 	PipestancePath string
+	Owner          *LockInfo
+
+	// Why the lock could not be taken over, if that was attempted.
+	TakeoverError error
 }
 
 func (self *PipestanceLockedError) Error() string {
-	return fmt.Sprintf("RuntimeError: pipestance '%s' already exists and is locked by another Martian instance. If you are sure no other Martian instance is running, delete the _lock file in %s and start Martian again.", self.Psid, self.PipestancePath)
+	owner := "another Martian instance"
+	if self.Owner != nil {
+		owner = self.Owner.String()
+	}
+	if self.TakeoverError != nil {
+		return fmt.Sprintf("RuntimeError: pipestance '%s' is locked by %s. Cannot take over the lock because %v. If you are sure no other Martian instance is running, delete the _lock file in %s and start Martian again.", self.Psid, owner, self.TakeoverError, self.PipestancePath)
+	}
+	return fmt.Sprintf("RuntimeError: pipestance '%s' already exists and is locked by %s. If you are sure no other Martian instance is running, restart with --force-takeover, or delete the _lock file in %s and start Martian again.", self.Psid, owner, self.PipestancePath)
 }
 
 // PipestanceNotFailedError
@@ -0,0 +1,338 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+// Statistics on stage run times and resource usage from previous runs of a
+// pipeline version, and estimation of the remaining time for a pipestance
+// based on them.
+//
+
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Stage timings are averaged over at most this many runs, so that the
+// estimates track changes in typical inputs.
+const historyWindow = 20
+
+// The mean wall time and resource usage of a stage over previous runs.
+// For stages with multiple forks, wall time and maximum RSS are for the
+// longest or largest fork, and core and memory hours are the total.
+type StageStats struct {
+	Runs       int     `json:"runs"`
+	WallTime   float64 `json:"walltime"`
+	CoreHours  float64 `json:"core_hours"`
+	MemGBHours float64 `json:"mem_gb_hours"`
+
+	// In kilobytes.
+	MaxRss float64 `json:"maxrss"`
+}
+
+func (self *StageStats) add(sample *StageStats) {
+	if self.Runs < historyWindow {
+		self.Runs++
+	}
+	n := float64(self.Runs)
+	self.WallTime += (sample.WallTime - self.WallTime) / n
+	self.CoreHours += (sample.CoreHours - self.CoreHours) / n
+	self.MemGBHours += (sample.MemGBHours - self.MemGBHours) / n
+	self.MaxRss += (sample.MaxRss - self.MaxRss) / n
+}
+
+// Historical stage statistics for one version of a pipeline.  Histories for
+// all pipelines are kept as json files in a shared directory, which can be
+// read by other tools for capacity planning.
+type PipelineHistory struct {
+	Pipeline string `json:"pipeline"`
+	Version  string `json:"version"`
+
+	// Statistics keyed by stage fqname, relative to the pipeline.
+	Stages map[string]*StageStats `json:"stages"`
+
+	// Statistics keyed by input size bucket and then by stage, for runs
+	// with similar total input file sizes.
+	InputSizes map[string]map[string]*StageStats `json:"by_input_size,omitempty"`
+
+	path string
+}
+
+var historyNameRe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Loads the history for the given pipeline version from dir.  If no history
+// exists yet, an empty one is returned.
+func LoadPipelineHistory(dir, pipeline, version string) (*PipelineHistory, error) {
+	history := &PipelineHistory{
+		Pipeline: pipeline,
+		Version:  version,
+		path: path.Join(dir, historyNameRe.ReplaceAllString(
+			pipeline+"-"+version, "_")+".json"),
+	}
+	return history, history.load()
+}
+
+func (self *PipelineHistory) load() error {
+	self.Stages = nil
+	self.InputSizes = nil
+	b, err := ioutil.ReadFile(self.path)
+	if err == nil {
+		err = json.Unmarshal(b, self)
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	if self.Stages == nil {
+		self.Stages = make(map[string]*StageStats)
+	}
+	if self.InputSizes == nil {
+		self.InputSizes = make(map[string]map[string]*StageStats)
+	}
+	return err
+}
+
+// Writes the history back to its file.
+func (self *PipelineHistory) Save() error {
+	b, err := json.MarshalIndent(self, "", "    ")
+	if err != nil {
+		return err
+	}
+	// Each writer needs its own temporary file, since pipestances on other
+	// hosts may share the history directory.
+	f, err := ioutil.TempFile(path.Dir(self.path), path.Base(self.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err = f.Write(b); err != nil {
+		f.Close()
+	} else if err = f.Close(); err == nil {
+		// Histories are meant to be readable by other tools.
+		if err = os.Chmod(tmp, 0644); err == nil {
+			err = os.Rename(tmp, self.path)
+		}
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// Takes an exclusive lock on the history file, to serialize updates from
+// concurrent pipestances.  The lock is released when the returned file is
+// closed.
+func (self *PipelineHistory) lock() (*os.File, error) {
+	f, err := os.OpenFile(self.path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (self *PipelineHistory) record(stage, bucket string, sample *StageStats) {
+	stats := self.Stages[stage]
+	if stats == nil {
+		stats = new(StageStats)
+		self.Stages[stage] = stats
+	}
+	stats.add(sample)
+	if bucket == "" {
+		return
+	}
+	buck := self.InputSizes[bucket]
+	if buck == nil {
+		buck = make(map[string]*StageStats)
+		self.InputSizes[bucket] = buck
+	}
+	stats = buck[stage]
+	if stats == nil {
+		stats = new(StageStats)
+		buck[stage] = stats
+	}
+	stats.add(sample)
+}
+
+// Gets the statistics for a stage, preferring those from runs with similar
+// input sizes.
+func (self *PipelineHistory) get(stage, bucket string) *StageStats {
+	if stats := self.InputSizes[bucket][stage]; stats != nil {
+		return stats
+	}
+	return self.Stages[stage]
+}
+
+// Adds the stages of a completed pipestance to the history file.  The file
+// is locked and re-read first, to pick up runs recorded by other pipestances
+// since this history was loaded.  This object is not modified.
+func (self *PipelineHistory) RecordPipestance(pipestance *Pipestance) error {
+	lock, err := self.lock()
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	current := &PipelineHistory{
+		Pipeline: self.Pipeline,
+		Version:  self.Version,
+		path:     self.path,
+	}
+	if err := current.load(); err != nil {
+		return err
+	}
+	bucket := pipestance.inputSizeBucket()
+	for _, node := range pipestance.allNodes() {
+		if node.kind != "stage" || node.getState() != Complete {
+			continue
+		}
+		perf, _ := node.serializePerf()
+		var sample StageStats
+		for _, fork := range perf.Forks {
+			if stats := fork.ForkStats; stats != nil {
+				if stats.WallTime > sample.WallTime {
+					sample.WallTime = stats.WallTime
+				}
+				if rss := float64(stats.MaxRss); rss > sample.MaxRss {
+					sample.MaxRss = rss
+				}
+				sample.CoreHours += stats.CoreHours
+				sample.MemGBHours += stats.MemGBHours
+			}
+		}
+		if sample.WallTime > 0 {
+			current.record(pipestance.relativeName(node), bucket, &sample)
+		}
+	}
+	return current.Save()
+}
+
+// Returns the name of the node relative to the pipeline.
+func (self *Pipestance) relativeName(node *Node) string {
+	return strings.TrimPrefix(node.fqname, self.node.fqname+".")
+}
+
+// Returns the total size of the files given as arguments to the pipeline,
+// rounded down to a power of 4 GB.
+func (self *Pipestance) inputSizeBucket() string {
+	invocation := self.node.parent.getNode().invocation
+	if invocation == nil {
+		return ""
+	}
+	return inputSizeBucket(boundFileBytes(invocation.Args))
+}
+
+func inputSizeBucket(size int64) string {
+	const gb = 1024 * 1024 * 1024
+	if size < gb {
+		return "<1G"
+	}
+	bucket := int64(1)
+	for size >= 4*bucket*gb {
+		bucket *= 4
+	}
+	return strconv.FormatInt(bucket, 10) + "G"
+}
+
+// The estimated progress of a pipestance.
+type ProgressEstimate struct {
+	CompleteStages int `json:"complete_stages"`
+	TotalStages    int `json:"total_stages"`
+
+	// The number of incomplete stages with no history.  These are not
+	// included in the remaining time.
+	UnknownStages int `json:"unknown_stages"`
+
+	// The estimated seconds until the pipestance completes, following the
+	// longest chain of dependent stages.
+	Remaining float64 `json:"remaining_seconds"`
+}
+
+// Estimates pipestance progress from a pipeline history.  The estimate is
+// refined as stages start and complete.
+type ProgressEstimator struct {
+	history *PipelineHistory
+	bucket  *string
+
+	// The time each running stage was first seen running.
+	started map[string]time.Time
+	lock    sync.Mutex
+}
+
+func NewProgressEstimator(history *PipelineHistory) *ProgressEstimator {
+	return &ProgressEstimator{
+		history: history,
+		started: make(map[string]time.Time),
+	}
+}
+
+func (self *ProgressEstimator) Estimate(pipestance *Pipestance) *ProgressEstimate {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.bucket == nil {
+		bucket := pipestance.inputSizeBucket()
+		self.bucket = &bucket
+	}
+	var est ProgressEstimate
+	now := time.Now()
+	remaining := make(map[*Node]float64)
+	for _, node := range pipestance.allNodes() {
+		if node.kind != "stage" {
+			continue
+		}
+		est.TotalStages++
+		name := pipestance.relativeName(node)
+		switch node.getState() {
+		case Complete, DisabledState:
+			est.CompleteStages++
+			delete(self.started, name)
+			continue
+		case Running:
+			if _, ok := self.started[name]; !ok {
+				self.started[name] = now
+			}
+		}
+		timing := self.history.get(name, *self.bucket)
+		if timing == nil {
+			est.UnknownStages++
+			continue
+		}
+		r := timing.WallTime
+		if start, ok := self.started[name]; ok {
+			r -= now.Sub(start).Seconds()
+		}
+		if r > 0 {
+			remaining[node] = r
+		}
+	}
+	finish := make(map[*Node]float64, len(remaining))
+	var finishTime func(*Node) float64
+	finishTime = func(node *Node) float64 {
+		if t, ok := finish[node]; ok {
+			return t
+		}
+		var t float64
+		for _, prenode := range node.prenodes {
+			if pt := finishTime(prenode.getNode()); pt > t {
+				t = pt
+			}
+		}
+		t += remaining[node]
+		finish[node] = t
+		return t
+	}
+	for node := range remaining {
+		if t := finishTime(node); t > est.Remaining {
+			est.Remaining = t
+		}
+	}
+	return &est
+}
@@ -0,0 +1,66 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestPipelineHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestPipelineHistory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	history, err := LoadPipelineHistory(dir, "PIPE", "v1.0 (abc)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	history.record("STAGE", "1G", &StageStats{WallTime: 10, CoreHours: 1})
+	history.record("STAGE", "4G", &StageStats{WallTime: 20, CoreHours: 3})
+	if err := history.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if files, err := ioutil.ReadDir(dir); err != nil {
+		t.Error(err)
+	} else if len(files) != 1 || files[0].Mode().Perm() != 0644 {
+		t.Errorf("Expected only the readable history file, got %v", files)
+	}
+	history, err = LoadPipelineHistory(dir, "PIPE", "v1.0 (abc)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := history.Stages["STAGE"]; stats == nil {
+		t.Error("Expected STAGE stats to be saved.")
+	} else if stats.Runs != 2 || stats.WallTime != 15 || stats.CoreHours != 2 {
+		t.Errorf("Expected 2 runs averaging 15s and 2 core hours, "+
+			"got %d runs averaging %gs and %g core hours",
+			stats.Runs, stats.WallTime, stats.CoreHours)
+	}
+	if stats := history.get("STAGE", "4G"); stats == nil || stats.WallTime != 20 {
+		t.Error("Expected 4G input size stats to be used.")
+	}
+	if stats := history.get("STAGE", "16G"); stats == nil || stats.WallTime != 15 {
+		t.Error("Expected overall stats for an unknown input size.")
+	}
+}
+
+func TestInputSizeBucket(t *testing.T) {
+	const gb = 1024 * 1024 * 1024
+	for size, expect := range map[int64]string{
+		0:         "<1G",
+		gb:        "1G",
+		4*gb - 1:  "1G",
+		4 * gb:    "4G",
+		100 * gb:  "64G",
+		1024 * gb: "1024G",
+	} {
+		if b := inputSizeBucket(size); b != expect {
+			t.Errorf("Expected %d bytes in bucket %s, got %s", size, expect, b)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+// Retrying metadata I/O through brief network filesystem outages.
+//
+
+package core
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+const (
+	// The number of times to attempt a metadata operation which fails with
+	// a transient error.  Attempts are made without waiting, since callers
+	// may be holding locks.
+	ioRetryAttempts = 3
+
+	// How long to pause stepping the pipestance after a metadata operation
+	// fails with a transient error even after retries.
+	ioBreakerPause = 2 * time.Minute
+
+	// The initial and maximum waits between attempts to flush held writes
+	// in processes without a step loop.
+	ioFlushInitialWait = time.Second
+	ioFlushMaxWait     = 30 * time.Second
+)
+
+// Returns true if the error is likely to be caused by a transient problem
+// with a network filesystem, such as a filer failover, which may succeed if
+// tried again.
+func isTransientIOError(err error) bool {
+	switch e := err.(type) {
+	case *os.PathError:
+		err = e.Err
+	case *os.LinkError:
+		err = e.Err
+	case *os.SyscallError:
+		err = e.Err
+	}
+	switch err {
+	case syscall.ESTALE, syscall.ETIMEDOUT, syscall.EAGAIN, syscall.EINTR:
+		return true
+	}
+	return false
+}
+
+// Runs f, retrying immediately if it fails with a transient error.  Since f
+// is expected to open files by path, retrying recovers from stale file
+// handles.  If the error persists, the circuit breaker is tripped, so that
+// stepping pauses rather than each operation blocking until the filesystem
+// recovers.
+func retryIO(f func() error) error {
+	for i := 1; ; i++ {
+		err := f()
+		if err == nil || !isTransientIOError(err) {
+			return err
+		}
+		if i >= ioRetryAttempts {
+			ioBreaker.trip(err)
+			return err
+		}
+	}
+}
+
+// A metadata write which failed with a transient error, held until the
+// filesystem recovers.
+type heldWrite struct {
+	metadata *Metadata
+	name     MetadataFileName
+	write    func() error
+}
+
+// Pauses pipestance stepping while the filesystem is unhealthy, so that
+// pipestances wait out a failover rather than failing.  Writes which fail
+// during the outage are held, rather than failing the stage, and are
+// retried in order before stepping resumes.
+type ioCircuitBreaker struct {
+	lock      sync.Mutex
+	openUntil time.Time
+	held      []heldWrite
+}
+
+var ioBreaker ioCircuitBreaker
+
+func (self *ioCircuitBreaker) trip(err error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if time.Now().After(self.openUntil) {
+		util.PrintError(err, "runtime",
+			"Metadata I/O is failing.  Pausing for %s.", ioBreakerPause)
+	}
+	self.openUntil = time.Now().Add(ioBreakerPause)
+}
+
+// Returns true if stepping should be paused.
+func (self *ioCircuitBreaker) isOpen() bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return time.Now().Before(self.openUntil)
+}
+
+func (self *ioCircuitBreaker) _forgetNoLock(metadata *Metadata, name MetadataFileName) {
+	held := self.held[:0]
+	for _, w := range self.held {
+		if w.metadata != metadata || (name != AnyFile && w.name != name) {
+			held = append(held, w)
+		}
+	}
+	self.held = held
+}
+
+// Holds a failed write to be retried once the filesystem recovers.  Any
+// write of the same file which is already held is replaced.
+func (self *ioCircuitBreaker) hold(metadata *Metadata, name MetadataFileName,
+	write func() error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self._forgetNoLock(metadata, name)
+	self.held = append(self.held, heldWrite{metadata, name, write})
+}
+
+// Drops any held write of the given file, for instance because it has since
+// been written successfully, so that it will not be overwritten with stale
+// content.  AnyFile drops all held writes for the metadata.
+func (self *ioCircuitBreaker) forget(metadata *Metadata, name MetadataFileName) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if len(self.held) > 0 {
+		self._forgetNoLock(metadata, name)
+	}
+}
+
+// Retries held writes in the order they were made.  Returns false if the
+// filesystem is still failing, in which case the remaining writes are held
+// again.
+func (self *ioCircuitBreaker) flush() bool {
+	self.lock.Lock()
+	held := self.held
+	self.held = nil
+	self.lock.Unlock()
+	for i, w := range held {
+		if err := retryIO(w.write); err == nil {
+			w.metadata.cache(w.name, w.metadata.uniquifier)
+		} else if isTransientIOError(err) {
+			self.lock.Lock()
+			// Writes held since the flush started are newer.
+			for _, w := range held[i:] {
+				if !self._holdsNoLock(w.metadata, w.name) {
+					self.held = append(self.held, w)
+				}
+			}
+			self.lock.Unlock()
+			return false
+		} else {
+			w.metadata.writeFailed(w.name, err)
+		}
+	}
+	return true
+}
+
+func (self *ioCircuitBreaker) _holdsNoLock(metadata *Metadata, name MetadataFileName) bool {
+	for _, w := range self.held {
+		if w.metadata == metadata && w.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Retries metadata writes which failed with transient errors, with backoff,
+// until they succeed or the timeout expires.  Processes which have no step
+// loop to flush held writes, such as mrjob, should call this before
+// exiting.  Returns false if writes are still held.
+func FlushMetadataWrites(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	wait := ioFlushInitialWait
+	for !ioBreaker.flush() {
+		if time.Now().Add(wait).After(deadline) {
+			return false
+		}
+		time.Sleep(wait)
+		if wait *= 2; wait > ioFlushMaxWait {
+			wait = ioFlushMaxWait
+		}
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryIO(t *testing.T) {
+	attempts := 0
+	if err := retryIO(func() error {
+		attempts++
+		if attempts < 3 {
+			return &os.PathError{Op: "open", Path: "_outs", Err: syscall.ESTALE}
+		}
+		return nil
+	}); err != nil {
+		t.Error(err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+	attempts = 0
+	if err := retryIO(func() error {
+		attempts++
+		return &os.PathError{Op: "open", Path: "_outs", Err: syscall.ENOENT}
+	}); !os.IsNotExist(err) {
+		t.Errorf("Expected not exist error, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("Expected no retries for a missing file, got %d attempts",
+			attempts)
+	}
+	if ioBreaker.isOpen() {
+		t.Error("Expected circuit breaker to be closed.")
+	}
+	attempts = 0
+	if err := retryIO(func() error {
+		attempts++
+		return &os.PathError{Op: "open", Path: "_outs", Err: syscall.EIO}
+	}); err == nil {
+		t.Error("Expected an error.")
+	}
+	if attempts != 1 {
+		t.Errorf("Expected no retries for an I/O error, got %d attempts",
+			attempts)
+	}
+	attempts = 0
+	if err := retryIO(func() error {
+		attempts++
+		return &os.PathError{Op: "open", Path: "_outs", Err: syscall.ESTALE}
+	}); err == nil {
+		t.Error("Expected an error.")
+	}
+	if attempts != ioRetryAttempts {
+		t.Errorf("Expected %d attempts, got %d", ioRetryAttempts, attempts)
+	}
+	if !ioBreaker.isOpen() {
+		t.Error("Expected circuit breaker to be open.")
+	}
+	ioBreaker.openUntil = time.Time{}
+}
+
+// Tests that a write which fails for longer than the immediate retries is
+// held, rather than failing the stage, and is completed once the filesystem
+// recovers.
+func TestHeldWrites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestHeldWrites")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() {
+		writeMetadataFile = ioutil.WriteFile
+		ioBreaker.openUntil = time.Time{}
+		ioBreaker.held = nil
+	}()
+	failures := 2*ioRetryAttempts + 1
+	writeMetadataFile = func(p string, b []byte, mode os.FileMode) error {
+		if failures > 0 {
+			failures--
+			return &os.PathError{Op: "open", Path: p, Err: syscall.ESTALE}
+		}
+		return ioutil.WriteFile(p, b, mode)
+	}
+	metadata := NewMetadata("ID.test.STAGE", dir)
+	if err := metadata.WriteTime(CompleteFile); err == nil {
+		t.Error("Expected the write to fail.")
+	}
+	if !ioBreaker.isOpen() {
+		t.Error("Expected circuit breaker to be open.")
+	}
+	if state, _ := metadata.getState(); state != Waiting {
+		t.Errorf("Expected waiting state, got %v", state)
+	}
+	if ioBreaker.flush() {
+		t.Error("Expected flush to fail while the filesystem is failing.")
+	}
+	if !ioBreaker.flush() {
+		t.Error("Expected flush to succeed.")
+	}
+	if state, _ := metadata.getState(); state != Complete {
+		t.Errorf("Expected complete state, got %v", state)
+	}
+	if _, err := os.Stat(metadata.MetadataFilePath(Errors)); !os.IsNotExist(err) {
+		t.Error("Expected no errors file.")
+	}
+	if len(ioBreaker.held) != 0 {
+		t.Errorf("Expected no held writes, got %d", len(ioBreaker.held))
+	}
+}
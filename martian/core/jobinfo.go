@@ -24,6 +24,26 @@ type JobInfo struct {
 	Invocation    *InvocationData   `json:"invocation,omitempty"`
 	Version       *VersionInfo      `json:"version,omitempty"`
 	ClusterEnv    map[string]string `json:"sge,omitempty"`
+	Environment   *JobEnvironment   `json:"environment,omitempty"`
+
+	// The time at which mrp queued the job.
+	Queued string `json:"queued,omitempty"`
+
+	// The time at which the job was handed to the job manager, after any
+	// local resource or rate limits were satisfied.
+	Submitted string `json:"submitted,omitempty"`
+
+	// The number of attempts made to submit the job.
+	SubmitAttempts int `json:"submit_attempts,omitempty"`
+
+	// If nonzero, the job is killed if it runs longer than this.
+	WallTimeHours int `json:"walltime_hours,omitempty"`
+
+	// The total size of the files bound to the job's arguments, recorded
+	// when the job is queued, and of the files bound to its outputs,
+	// recorded when it completes.
+	BoundInputBytes  int64 `json:"bound_input_bytes,omitempty"`
+	BoundOutputBytes int64 `json:"bound_output_bytes,omitempty"`
 }
 
 type PythonInfo struct {
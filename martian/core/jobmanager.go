@@ -5,12 +5,15 @@ package core
 // Martian job managers for local and remote (SGE, LSF, etc) modes.
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -22,7 +25,7 @@ import (
 // Job managers
 //
 type JobManager interface {
-	execJob(string, []string, map[string]string, *Metadata, int, int, string, string, string, bool)
+	execJob(string, []string, map[string]string, *Metadata, int, int, int, string, string, string, bool)
 	endJob(*Metadata)
 
 	// Given a list of candidate job IDs, returns a list of jobIds which may be
@@ -38,6 +41,11 @@ type JobManager interface {
 	// whatever the queue manager uses to syncronize state.
 	queueCheckGrace() time.Duration
 
+	// Cancels the given queued or running jobs.
+	killJobs([]string, context.Context) error
+	// Returns true if killJobs does something useful.
+	canKillJobs() bool
+
 	// Update resouce availability.
 	//
 	// For local mode, this means free memory and possibly loadavg.
@@ -73,19 +81,52 @@ type JobModeEnv struct {
 	Description string `json:"description"`
 }
 
+// A command to run when mrp starts, to verify that the cluster is usable.
+//
+// References to ${NAME} in the arguments and remediation are replaced with
+// the value of the environment variable NAME, except for ${MATCH}, which is
+// the value matched by TemplateMatch, and ${MRO_THREADS}, which is the
+// default number of threads per job.
+type JobModeCheck struct {
+	Name string   `json:"name"`
+	Cmd  string   `json:"cmd"`
+	Args []string `json:"args,omitempty"`
+
+	// If set, the check only runs if the job template matches this regular
+	// expression, e.g. only check that a queue exists if the template
+	// requests one.  The first capture group is available as ${MATCH}.
+	TemplateMatch string `json:"template_match,omitempty"`
+
+	// Instead of running a command, submit a job which checks that the
+	// directory mrp is running in is visible from the compute nodes.
+	ProbeJob bool `json:"probe_job,omitempty"`
+
+	// How long to wait for a probe job to finish.  Defaults to 10 minutes.
+	TimeoutSecs int `json:"timeout_secs,omitempty"`
+
+	// Instructions for the user if the check fails.
+	Remediation string `json:"remediation,omitempty"`
+}
+
 type JobModeJson struct {
-	Cmd             string        `json:"cmd"`
-	Args            []string      `json:"args,omitempty"`
-	QueueQuery      string        `json:"queue_query,omitempty"`
-	QueueQueryGrace int           `json:"queue_query_grace_secs,omitempty"`
-	ResourcesOpt    string        `json:"resopt"`
-	JobEnvs         []*JobModeEnv `json:"envs"`
+	Cmd             string          `json:"cmd"`
+	Args            []string        `json:"args,omitempty"`
+	QueueQuery      string          `json:"queue_query,omitempty"`
+	QueueQueryGrace int             `json:"queue_query_grace_secs,omitempty"`
+	KillCmd         string          `json:"kill_cmd,omitempty"`
+	SubmitRetries   *int            `json:"submit_retries,omitempty"`
+	ResourcesOpt    string          `json:"resopt"`
+	JobEnvs         []*JobModeEnv   `json:"envs"`
+	Checks          []*JobModeCheck `json:"checks,omitempty"`
 }
 
 type JobManagerSettings struct {
 	ThreadsPerJob int      `json:"threads_per_job"`
 	MemGBPerJob   int      `json:"memGB_per_job"`
 	ThreadEnvs    []string `json:"thread_envs"`
+
+	// The default walltime limit for jobs, in hours.  Zero means no limit.
+	WallTimeHours int `json:"walltime_hours_per_job,omitempty"`
 }
 
 type JobManagerJson struct {
@@ -100,9 +141,13 @@ type jobManagerConfig struct {
 	jobCmdArgs       []string
 	queueQueryCmd    string
 	queueQueryGrace  time.Duration
+	killCmd          string
+	submitRetries    int
 	jobResourcesOpt  string
 	jobTemplate      string
+	jobTemplateFile  string
 	threadingEnabled bool
+	probeChecks      []*JobModeCheck
 }
 
 func getJobConfig(profileMode ProfileMode) *JobManagerJson {
@@ -158,6 +203,74 @@ func getJobConfig(profileMode ProfileMode) *JobManagerJson {
 	return jobJson
 }
 
+var checkArgVar = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// Expand ${NAME} references in a cluster check argument.  Unbraced $NAME
+// references are left alone so that checks can pass scripts to sh -c.
+func expandCheckArg(arg string, vars map[string]string) string {
+	return checkArgVar.ReplaceAllStringFunc(arg, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		if v, ok := vars[name]; ok {
+			return v
+		}
+		return os.Getenv(name)
+	})
+}
+
+// Runs the configured preflight checks for a cluster job mode, exiting with
+// the check's remediation message if any of them fail.  Probe job checks are
+// not run here, but are returned for the job manager to submit.
+func runClusterChecks(jobMode string, checks []*JobModeCheck,
+	jobTemplate string, settings *JobManagerSettings) []*JobModeCheck {
+	var probes []*JobModeCheck
+	for _, check := range checks {
+		if check.ProbeJob {
+			probes = append(probes, check)
+			continue
+		}
+		vars := map[string]string{
+			"MRO_THREADS": strconv.Itoa(settings.ThreadsPerJob),
+		}
+		if check.TemplateMatch != "" {
+			re, err := regexp.Compile(check.TemplateMatch)
+			if err != nil {
+				util.PrintInfo("jobmngr",
+					"Cluster check '%s' has an invalid template_match: %v",
+					check.Name, err)
+				os.Exit(1)
+			}
+			m := re.FindStringSubmatch(jobTemplate)
+			if m == nil {
+				util.LogInfo("jobmngr",
+					"Cluster check %s skipped, since the job template does not use it.",
+					check.Name)
+				continue
+			}
+			if len(m) > 1 {
+				vars["MATCH"] = m[1]
+			}
+		}
+		args := make([]string, len(check.Args))
+		for i, arg := range check.Args {
+			args[i] = expandCheckArg(arg, vars)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		output, err := exec.CommandContext(ctx, check.Cmd, args...).CombinedOutput()
+		cancel()
+		if err != nil {
+			util.Println("\nCLUSTER PREFLIGHT FAILED:\n   Check '%s' for job mode %s failed: %v\n   %s %s\n%s",
+				check.Name, jobMode, err, check.Cmd, strings.Join(args, " "),
+				bytes.TrimSpace(output))
+			if check.Remediation != "" {
+				util.Println("\n%s\n", expandCheckArg(check.Remediation, vars))
+			}
+			os.Exit(1)
+		}
+		util.LogInfo("jobmngr", "Cluster check %s passed.", check.Name)
+	}
+	return probes
+}
+
 func verifyJobManager(jobMode string, jobJson *JobManagerJson, memGBPerCore int) jobManagerConfig {
 	if jobMode == "local" {
 		// Local job mode only needs to verify settings parameters
@@ -233,6 +346,36 @@ func verifyJobManager(jobMode string, jobJson *JobManagerJson, memGBPerCore int)
 	}
 	util.EnvRequire(envs, true)
 
+	if jobModeJson.KillCmd != "" {
+		if _, found := util.SearchPaths(jobModeJson.KillCmd, incPaths); !found {
+			util.Println("Job kill command '%s' not found in (%s)",
+				jobModeJson.KillCmd, strings.Join(incPaths, ", "))
+			os.Exit(1)
+		}
+		util.LogInfo("jobmngr", "Job kill command = %s", jobModeJson.KillCmd)
+	}
+	if jobModeJson.QueueQuery != "" {
+		queryCmd := path.Join(util.RelPath(path.Join("..", "jobmanagers")),
+			jobModeJson.QueueQuery)
+		if info, err := os.Stat(queryCmd); err != nil || info.Mode()&0111 == 0 {
+			util.PrintInfo("jobmngr",
+				"WARNING: Queue query command %s does not exist or is not executable.\n"+
+					"Jobs which are lost by the cluster will not be detected.",
+				queryCmd)
+			jobModeJson.QueueQuery = ""
+		}
+	}
+	probeChecks := runClusterChecks(jobMode, jobModeJson.Checks,
+		jobTemplate, jobJson.JobSettings)
+
+	// Default to retrying failed submissions a few times, since a
+	// transient failure of the submit command usually means the scheduler
+	// is overloaded.
+	submitRetries := 3
+	if jobModeJson.SubmitRetries != nil {
+		submitRetries = *jobModeJson.SubmitRetries
+	}
+
 	var queueGrace time.Duration
 	if jobModeJson.QueueQuery != "" {
 		queueGrace = time.Duration(jobModeJson.QueueQueryGrace) * time.Second
@@ -248,8 +391,12 @@ func verifyJobManager(jobMode string, jobJson *JobManagerJson, memGBPerCore int)
 		jobModeJson.Args,
 		jobModeJson.QueueQuery,
 		queueGrace,
+		jobModeJson.KillCmd,
+		submitRetries,
 		jobResourcesOpt,
 		jobTemplate,
+		jobTemplateFile,
 		jobThreadingEnabled,
+		probeChecks,
 	}
 }
@@ -5,11 +5,13 @@ package core
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"os/exec"
 	"runtime"
 	"runtime/trace"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -45,6 +47,7 @@ const (
 
 type LocalJobManager struct {
 	maxCores    int
+	sysCores    int
 	maxMemGB    int
 	jobSettings *JobManagerSettings
 	coreSem     *ResourceSemaphore
@@ -70,6 +73,7 @@ func NewLocalJobManager(userMaxCores int, userMaxMemGB int,
 		jobDone: make(chan struct{}, 1),
 	}
 	self.jobSettings = verifyJobManager("local", config, -1).jobSettings
+	self.sysCores = availableCPUs(runtime.NumCPU())
 
 	// Set Max number of cores usable at one time.
 	if userMaxCores > 0 {
@@ -82,10 +86,15 @@ func NewLocalJobManager(userMaxCores int, userMaxMemGB int,
 			self.maxCores = self.jobSettings.ThreadsPerJob
 		} else {
 			// Otherwise, set Max usable cores to total number of cores reported
-			// by the system.
-			self.maxCores = runtime.NumCPU()
-			util.LogInfo("jobmngr", "Using %d logical core%s available on system.",
-				self.maxCores, util.Pluralize(self.maxCores))
+			// by the system, or allowed by the cgroup CPU quota in a container.
+			self.maxCores = self.sysCores
+			if self.sysCores < runtime.NumCPU() {
+				util.LogInfo("jobmngr", "Using %d core%s allowed by cgroup CPU quota.",
+					self.maxCores, util.Pluralize(self.maxCores))
+			} else {
+				util.LogInfo("jobmngr", "Using %d logical core%s available on system.",
+					self.maxCores, util.Pluralize(self.maxCores))
+			}
 		}
 	}
 
@@ -202,7 +211,7 @@ func (self *LocalJobManager) refreshResources(localMode bool) error {
 			return err
 		}
 		if diff := self.coreSem.UpdateActual(int64(
-			float64(runtime.NumCPU()) - load.One + 0.9)); diff < -int64(self.maxCores)/4 &&
+			float64(self.sysCores) - load.One + 0.9)); diff < -int64(self.maxCores)/4 &&
 			localMode {
 			util.LogInfo("jobmngr", "%d fewer core%s than expected were free.", -diff, util.Pluralize(int(-diff)))
 		}
@@ -290,9 +299,27 @@ func (self *LocalJobManager) queueCheckGrace() time.Duration {
 	return 0
 }
 
+func (self *LocalJobManager) killJobs([]string, context.Context) error {
+	return nil
+}
+
+func (self *LocalJobManager) canKillJobs() bool {
+	return false
+}
+
 func (self *LocalJobManager) Enqueue(shellCmd string, argv []string,
 	envs map[string]string, metadata *Metadata, threads int, memGB int,
 	fqname string, retries int, waitTime int, localpreflight bool) {
+	self.enqueue(shellCmd, argv, envs, metadata, threads, memGB, 0,
+		fqname, retries, waitTime, localpreflight)
+}
+
+// Same as Enqueue, but kills the job if it runs for longer than
+// walltimeHours, if that is nonzero.
+func (self *LocalJobManager) enqueue(shellCmd string, argv []string,
+	envs map[string]string, metadata *Metadata, threads int, memGB int,
+	walltimeHours int, fqname string, retries int, waitTime int,
+	localpreflight bool) {
 
 	time.Sleep(time.Second * time.Duration(waitTime))
 	go func() {
@@ -400,7 +427,9 @@ func (self *LocalJobManager) Enqueue(shellCmd string, argv []string,
 				util.LogInfo("jobmngr", "%d goroutines", runtime.NumGoroutine())
 			}
 		}
-		err := executeLocal(cmd, stdoutPath, stderrPath, localpreflight, metadata)
+		metadata.recordSubmit(retries + 1)
+		err := executeLocal(cmd, stdoutPath, stderrPath, localpreflight,
+			walltimeHours, metadata)
 		// CentOS < 5.5 workaround
 		if err != nil {
 			if strings.Contains(err.Error(), exitCodeString) {
@@ -424,8 +453,8 @@ func (self *LocalJobManager) Enqueue(shellCmd string, argv []string,
 				util.LogInfo("jobmngr",
 					"Job failed: %s. Retrying job %s in %d seconds",
 					err.Error(), fqname, waitTime)
-				self.Enqueue(shellCmd, argv, envs, metadata, threads, memGB, fqname, retries,
-					waitTime, localpreflight)
+				self.enqueue(shellCmd, argv, envs, metadata, threads, memGB,
+					walltimeHours, fqname, retries, waitTime, localpreflight)
 			}
 		} else {
 			// Notify
@@ -438,7 +467,7 @@ func (self *LocalJobManager) Enqueue(shellCmd string, argv []string,
 }
 
 func executeLocal(cmd *exec.Cmd, stdoutPath, stderrPath string,
-	localpreflight bool, metadata *Metadata) error {
+	localpreflight bool, walltimeHours int, metadata *Metadata) error {
 	// Set up _stdout and _stderr for the job.
 	if stdoutFile, err := os.Create(stdoutPath); err == nil {
 		stdoutFile.WriteString("[stdout]\n")
@@ -469,6 +498,20 @@ func executeLocal(cmd *exec.Cmd, stdoutPath, stderrPath string,
 	}(metadata, cmd); err != nil {
 		return err
 	}
+	if walltimeHours > 0 {
+		var timedOut int32
+		timer := time.AfterFunc(time.Duration(walltimeHours)*time.Hour, func() {
+			atomic.StoreInt32(&timedOut, 1)
+			cmd.Process.Kill()
+		})
+		err := cmd.Wait()
+		timer.Stop()
+		if atomic.LoadInt32(&timedOut) != 0 {
+			return fmt.Errorf("Stage exceeded its walltime limit of %d hour%s",
+				walltimeHours, util.Pluralize(walltimeHours))
+		}
+		return err
+	}
 	return cmd.Wait()
 }
 
@@ -487,8 +530,9 @@ func (self *LocalJobManager) GetMaxMemGB() int {
 
 func (self *LocalJobManager) execJob(shellCmd string, argv []string,
 	envs map[string]string, metadata *Metadata, threads int, memGB int,
-	special string, fqname string, shellName string, preflight bool) {
-	self.Enqueue(shellCmd, argv, envs, metadata, threads, memGB, fqname, 0, 0, preflight)
+	walltimeHours int, special string, fqname string, shellName string, preflight bool) {
+	self.enqueue(shellCmd, argv, envs, metadata, threads, memGB, walltimeHours,
+		fqname, 0, 0, preflight)
 }
 
 func (self *LocalJobManager) endJob(*Metadata) {}
@@ -6,11 +6,14 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
 	"runtime/trace"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/martian-lang/martian/martian/util"
@@ -34,8 +37,26 @@ type RemoteJobManager struct {
 	jobSem               *MaxJobsSemaphore
 	limiter              *time.Ticker
 	debug                bool
+
+	// After a failed job submission, further submissions are delayed until
+	// backoffUntil.  The delay doubles with each consecutive failure.
+	backoffLock  sync.Mutex
+	backoff      time.Duration
+	backoffUntil time.Time
+
+	// Serializes submissions when there is no limit on queued jobs.
+	unlimitedLock sync.Mutex
+
+	// Job templates for specific values of special, loaded on demand.
+	specialTemplates    map[string]string
+	specialTemplateLock sync.Mutex
 }
 
+const (
+	minSubmitBackoff = 5 * time.Second
+	maxSubmitBackoff = 5 * time.Minute
+)
+
 func NewRemoteJobManager(jobMode string, memGBPerCore int, maxJobs int, jobFreqMillis int,
 	jobResources string, config *JobManagerJson, debug bool) *RemoteJobManager {
 	self := &RemoteJobManager{}
@@ -69,9 +90,104 @@ func NewRemoteJobManager(jobMode string, memGBPerCore int, maxJobs int, jobFreqM
 		// dummy limiter to keep struct OK
 		self.limiter = time.NewTicker(time.Millisecond * 1)
 	}
+	if len(self.config.probeChecks) > 0 {
+		go self.runProbeJobs()
+	}
 	return self
 }
 
+const defaultProbeTimeout = 10 * time.Minute
+
+// Run the configured probe job checks.  This is done in the background so
+// that a busy queue does not delay the pipeline, so failures are reported as
+// warnings rather than preventing mrp from starting.
+func (self *RemoteJobManager) runProbeJobs() {
+	for _, check := range self.config.probeChecks {
+		if err := self.probeSharedFilesystem(check); err != nil {
+			util.PrintInfo("jobmngr",
+				"CLUSTER PREFLIGHT WARNING:\n   Check '%s' for job mode %s failed: %v\n\n%s\n",
+				check.Name, self.jobMode, err,
+				expandCheckArg(check.Remediation, nil))
+		} else {
+			util.LogInfo("jobmngr", "Cluster check %s passed.", check.Name)
+		}
+	}
+}
+
+// Submit a job which copies a file from a temporary directory under the
+// current directory to another file next to it, and wait for the copy to
+// appear.  If it does not, the compute nodes probably cannot see the
+// filesystem mrp is running on, and every job would fail.
+func (self *RemoteJobManager) probeSharedFilesystem(check *JobModeCheck) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir(cwd, ".mrp_fsprobe")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	token := strconv.FormatInt(time.Now().UnixNano(), 36)
+	src := path.Join(dir, "probe")
+	dest := path.Join(dir, "probe.out")
+	if err := ioutil.WriteFile(src, []byte(token), 0644); err != nil {
+		return err
+	}
+
+	threads, memGB := self.GetSystemReqs(1, 0)
+	params := map[string]string{
+		"JOB_NAME":          "mrp_fsprobe",
+		"THREADS":           strconv.Itoa(threads),
+		"STDOUT":            path.Join(dir, "stdout"),
+		"STDERR":            path.Join(dir, "stderr"),
+		"JOB_WORKDIR":       dir,
+		"CMD":               fmt.Sprintf("cp '%s' '%s'", src, dest),
+		"MEM_GB":            fmt.Sprintf("%d", memGB),
+		"MEM_MB":            fmt.Sprintf("%d", memGB*1024),
+		"MEM_KB":            fmt.Sprintf("%d", memGB*1024*1024),
+		"MEM_B":             fmt.Sprintf("%d", memGB*1024*1024*1024),
+		"MEM_GB_PER_THREAD": fmt.Sprintf("%d", memGB),
+		"MEM_MB_PER_THREAD": fmt.Sprintf("%d", memGB*1024),
+		"MEM_KB_PER_THREAD": fmt.Sprintf("%d", memGB*1024*1024),
+		"MEM_B_PER_THREAD":  fmt.Sprintf("%d", memGB*1024*1024*1024),
+		"ACCOUNT":           os.Getenv("MRO_ACCOUNT"),
+		"RESOURCES":         "",
+		"SPECIAL":           "",
+		"WALLTIME_HOURS":    "",
+		"WALLTIME":          "",
+	}
+	if h := self.config.jobSettings.WallTimeHours; h > 0 {
+		params["WALLTIME_HOURS"] = strconv.Itoa(h)
+		params["WALLTIME"] = fmt.Sprintf("%d:00:00", h)
+	}
+	cmd := exec.Command(self.config.jobCmd, self.config.jobCmdArgs...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(renderJobTemplate(self.config.jobTemplate, params))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("could not submit the probe job: %v\n%s", err, output)
+	}
+
+	timeout := defaultProbeTimeout
+	if check.TimeoutSecs > 0 {
+		timeout = time.Duration(check.TimeoutSecs) * time.Second
+	}
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); {
+		time.Sleep(5 * time.Second)
+		if b, err := ioutil.ReadFile(dest); err == nil && string(b) == token {
+			return nil
+		}
+	}
+	jobid := string(bytes.TrimSpace(output))
+	if jobid != "" && !strings.ContainsAny(jobid, " \t\n\r") {
+		if err := self.killJobs([]string{jobid}, context.Background()); err != nil {
+			util.LogError(err, "jobmngr", "Could not kill the probe job.")
+		}
+	}
+	return fmt.Errorf("the probe job did not finish within %s", timeout)
+}
+
 func (self *RemoteJobManager) refreshResources(bool) error {
 	if self.jobSem != nil {
 		self.jobSem.FindDone()
@@ -124,13 +240,22 @@ func (self *RemoteJobManager) GetSystemReqs(threads int, memGB int) (int, int) {
 
 func (self *RemoteJobManager) execJob(shellCmd string, argv []string,
 	envs map[string]string, metadata *Metadata, threads int, memGB int,
-	special string, fqname string, shellName string, localpreflight bool) {
+	walltimeHours int, special string, fqname string, shellName string,
+	localpreflight bool) {
 	ctx, task := trace.NewTask(context.Background(), "queueRemote")
 
 	// no limit, send the job
 	if self.maxJobs <= 0 {
-		defer task.End()
-		self.sendJob(shellCmd, argv, envs, metadata, threads, memGB, special, fqname, shellName, ctx)
+		// Send it in the background, so that rate limiting and backoff
+		// after failed submissions do not block the caller, but still one
+		// job at a time.
+		go func() {
+			defer task.End()
+			self.unlimitedLock.Lock()
+			defer self.unlimitedLock.Unlock()
+			self.sendJob(shellCmd, argv, envs, metadata, threads, memGB,
+				walltimeHours, special, fqname, shellName, ctx)
+		}()
 		return
 	}
 
@@ -148,7 +273,8 @@ func (self *RemoteJobManager) execJob(shellCmd string, argv []string,
 		if self.debug {
 			util.LogInfo("jobmngr", "Job sent: %s", fqname)
 		}
-		self.sendJob(shellCmd, argv, envs, metadata, threads, memGB, special, fqname, shellName, ctx)
+		self.sendJob(shellCmd, argv, envs, metadata, threads, memGB,
+			walltimeHours, special, fqname, shellName, ctx)
 	}()
 }
 
@@ -159,8 +285,8 @@ func (self *RemoteJobManager) endJob(metadata *Metadata) {
 }
 
 func (self *RemoteJobManager) sendJob(shellCmd string, argv []string, envs map[string]string,
-	metadata *Metadata, threads int, memGB int, special string, fqname string, shellName string,
-	ctx context.Context) {
+	metadata *Metadata, threads int, memGB int, walltimeHours int, special string,
+	fqname string, shellName string, ctx context.Context) {
 
 	if self.jobFreqMillis > 0 {
 		<-(self.limiter.C)
@@ -218,11 +344,42 @@ func (self *RemoteJobManager) sendJob(shellCmd string, argv []string, envs map[s
 		"MEM_B_PER_THREAD":  fmt.Sprintf("%d", memGBPerThread*1024*1024*1024),
 		"ACCOUNT":           os.Getenv("MRO_ACCOUNT"),
 		"RESOURCES":         mappedJobResourcesOpt,
+		"SPECIAL":           special,
+		"WALLTIME_HOURS":    "",
+		"WALLTIME":          "",
+	}
+	if walltimeHours > 0 {
+		params["WALLTIME_HOURS"] = strconv.Itoa(walltimeHours)
+		params["WALLTIME"] = fmt.Sprintf("%d:00:00", walltimeHours)
+	}
+
+	jobscript := renderJobTemplate(self.jobTemplate(special), params)
+	metadata.WriteRaw("jobscript", jobscript)
+
+	for attempt := 0; ; attempt++ {
+		self.waitForBackoff()
+		output, err := self.submit(jobscript, metadata, attempt, ctx)
+		if err == nil {
+			self.submitSucceeded()
+			return
+		}
+		delay := self.submitFailed()
+		if attempt >= self.config.submitRetries || ctx.Err() != nil {
+			util.EnterCriticalSection()
+			metadata.WriteRaw(Errors, "jobcmd error ("+err.Error()+"):\n"+string(output))
+			util.ExitCriticalSection()
+			return
+		}
+		util.LogInfo("jobmngr",
+			"Job submission for %s failed (%v).  Retrying in %s.\n%s",
+			fqname, err, delay, output)
 	}
+}
 
-	// Replace template annotations with actual values
+// Replace template annotations with actual values.  Lines containing
+// parameters with no value are removed from the template.
+func renderJobTemplate(template string, params map[string]string) string {
 	args := []string{}
-	template := self.config.jobTemplate
 	for key, val := range params {
 		if len(val) > 0 {
 			args = append(args, fmt.Sprintf("__MRO_%s__", key), val)
@@ -236,29 +393,98 @@ func (self *RemoteJobManager) sendJob(shellCmd string, argv []string, envs map[s
 		}
 	}
 	r := strings.NewReplacer(args...)
-	jobscript := r.Replace(template)
-	metadata.WriteRaw("jobscript", jobscript)
+	return r.Replace(template)
+}
 
+// Get the job template to use for jobs with the given special value.  If a
+// template file named <jobmode>.<special>.template exists next to the main
+// template, it is used instead, so that stages can be sent to e.g. a specific
+// queue without changing the template for all jobs.
+func (self *RemoteJobManager) jobTemplate(special string) string {
+	if special == "" || self.config.jobTemplateFile == "" ||
+		strings.ContainsAny(special, "/ ") {
+		return self.config.jobTemplate
+	}
+	self.specialTemplateLock.Lock()
+	defer self.specialTemplateLock.Unlock()
+	if t, ok := self.specialTemplates[special]; ok {
+		return t
+	}
+	if self.specialTemplates == nil {
+		self.specialTemplates = make(map[string]string)
+	}
+	t := self.config.jobTemplate
+	fn := strings.TrimSuffix(self.config.jobTemplateFile, ".template") +
+		"." + special + ".template"
+	if b, err := ioutil.ReadFile(fn); err == nil {
+		util.LogInfo("jobmngr", "Job template for %s = %s", special, fn)
+		t = string(b)
+	} else if !os.IsNotExist(err) {
+		util.LogError(err, "jobmngr", "Could not read job template %s", fn)
+	}
+	self.specialTemplates[special] = t
+	return t
+}
+
+// Run the job submit command with the given job script, and record the job
+// ID if it succeeds.
+func (self *RemoteJobManager) submit(jobscript string, metadata *Metadata,
+	attempt int, ctx context.Context) ([]byte, error) {
 	cmd := exec.CommandContext(ctx, self.config.jobCmd, self.config.jobCmdArgs...)
 	cmd.Dir = metadata.curFilesPath
 	cmd.Stdin = strings.NewReader(jobscript)
 
 	util.EnterCriticalSection()
 	defer util.ExitCriticalSection()
-	metadata.remove("queued_locally")
-	if output, err := cmd.CombinedOutput(); err != nil {
-		metadata.WriteRaw(Errors, "jobcmd error ("+err.Error()+"):\n"+string(output))
-	} else {
-		trimmed := bytes.TrimSpace(output)
-		// jobids should not have spaces in them.  This is the most general way to
-		// check that a string is actually a jobid.
-		if len(trimmed) > 0 && !bytes.ContainsAny(trimmed, " \t\n\r") {
-			metadata.WriteRawBytes("jobid", bytes.TrimSpace(output))
-			metadata.cache("jobid", metadata.uniquifier)
-		}
+	if attempt == 0 {
+		metadata.remove("queued_locally")
+	}
+	metadata.recordSubmit(attempt + 1)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return output, err
+	}
+	trimmed := bytes.TrimSpace(output)
+	// jobids should not have spaces in them.  This is the most general way to
+	// check that a string is actually a jobid.
+	if len(trimmed) > 0 && !bytes.ContainsAny(trimmed, " \t\n\r") {
+		metadata.WriteRawBytes("jobid", trimmed)
+		metadata.cache("jobid", metadata.uniquifier)
+	}
+	return output, nil
+}
+
+// Block until any backoff from previous submission failures has elapsed.
+func (self *RemoteJobManager) waitForBackoff() {
+	self.backoffLock.Lock()
+	wait := time.Until(self.backoffUntil)
+	self.backoffLock.Unlock()
+	if wait > 0 {
+		time.Sleep(wait)
 	}
 }
 
+// Record a submission failure, increasing the backoff for all submissions.
+// Returns the new backoff delay.
+func (self *RemoteJobManager) submitFailed() time.Duration {
+	self.backoffLock.Lock()
+	defer self.backoffLock.Unlock()
+	if self.backoff < minSubmitBackoff {
+		self.backoff = minSubmitBackoff
+	} else if self.backoff *= 2; self.backoff > maxSubmitBackoff {
+		self.backoff = maxSubmitBackoff
+	}
+	self.backoffUntil = time.Now().Add(self.backoff)
+	return self.backoff
+}
+
+// Record a submission success, which resets the backoff.
+func (self *RemoteJobManager) submitSucceeded() {
+	self.backoffLock.Lock()
+	self.backoff = 0
+	self.backoffLock.Unlock()
+}
+
 func (self *RemoteJobManager) checkQueue(ids []string, ctx context.Context) ([]string, string) {
 	if self.config.queueQueryCmd == "" {
 		return ids, ""
@@ -283,3 +509,20 @@ func (self *RemoteJobManager) hasQueueCheck() bool {
 func (self *RemoteJobManager) queueCheckGrace() time.Duration {
 	return self.config.queueQueryGrace
 }
+
+// Runs the configured kill command (e.g. qdel, scancel, bkill) with the given
+// job IDs as arguments.
+func (self *RemoteJobManager) killJobs(ids []string, ctx context.Context) error {
+	if self.config.killCmd == "" || len(ids) == 0 {
+		return nil
+	}
+	cmd := exec.CommandContext(ctx, self.config.killCmd, ids...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %v\n%s", self.config.killCmd, err, output)
+	}
+	return nil
+}
+
+func (self *RemoteJobManager) canKillJobs() bool {
+	return self.config.killCmd != ""
+}
@@ -0,0 +1,66 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// Tests that with no limit on queued jobs, backoff after a failed submission
+// does not block the caller.
+func TestUnlimitedSubmitBackoff(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("No shell available.")
+	}
+	dir, err := ioutil.TempDir("", "TestUnlimitedSubmitBackoff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	metadata := NewMetadata("ID.test.STAGE.fork0.chnk0", dir)
+	if err := os.MkdirAll(metadata.curFilesPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	self := &RemoteJobManager{
+		jobMode: "test",
+		config: jobManagerConfig{
+			jobSettings: &JobManagerSettings{
+				ThreadsPerJob: 1,
+				MemGBPerJob:   1,
+			},
+			jobCmd:        "sh",
+			jobCmdArgs:    []string{"-c", "cat > /dev/null; echo 12345"},
+			jobTemplate:   "__MRO_CMD__\n",
+			submitRetries: 1,
+		},
+	}
+	self.backoffUntil = time.Now().Add(time.Second)
+	util.SetupSignalHandlers()
+
+	start := time.Now()
+	self.execJob("true", nil, nil, metadata, 1, 1, 0, "",
+		"ID.test.STAGE.fork0.chnk0", "main", false)
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("Submission blocked for %v while backing off.", d)
+	}
+	jobid := path.Join(dir, "_jobid")
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); {
+		if b, err := ioutil.ReadFile(jobid); err == nil {
+			if s := strings.TrimSpace(string(b)); s != "12345" {
+				t.Errorf("Expected job id 12345, got %q", s)
+			}
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Error("Job was not submitted after the backoff expired.")
+}
@@ -0,0 +1,60 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+
+package core
+
+import (
+	"os"
+	"testing"
+)
+
+func TestExpandCheckArg(t *testing.T) {
+	defer setTestEnv(map[string]string{"MRO_TEST_QUEUE": "env.q"})()
+	vars := map[string]string{"MATCH": "threads", "MRO_THREADS": "4"}
+	check := func(arg, expect string) {
+		t.Helper()
+		if s := expandCheckArg(arg, vars); s != expect {
+			t.Errorf("Expected %q to expand to %q, got %q", arg, expect, s)
+		}
+	}
+	check("${MATCH}", "threads")
+	check("-q ${MRO_TEST_QUEUE}", "-q env.q")
+	check(`awk -v n="$1" '{ print $2 }' ${MRO_THREADS}`,
+		`awk -v n="$1" '{ print $2 }' 4`)
+}
+
+func TestRunClusterChecks(t *testing.T) {
+	template := "#$ -N __MRO_JOB_NAME__\n#$ -pe threads __MRO_THREADS__\n"
+	checks := []*JobModeCheck{
+		{
+			Name: "scheduler",
+			Cmd:  "true",
+		},
+		{
+			// The template does not request a queue, so this must be
+			// skipped rather than failing.
+			Name:          "queue",
+			TemplateMatch: `(?m)^#\$\s+-q\s+(\S+)`,
+			Cmd:           "false",
+		},
+		{
+			Name:          "parallel environment",
+			TemplateMatch: `(?m)^#\$\s+-pe\s+(\S+)`,
+			Cmd:           "sh",
+			Args:          []string{"-c", `test "$0" = threads`, "${MATCH}"},
+		},
+		{
+			Name:     "shared filesystem",
+			ProbeJob: true,
+		},
+	}
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("No shell available.")
+	}
+	probes := runClusterChecks("sge", checks, template,
+		&JobManagerSettings{ThreadsPerJob: 1})
+	if len(probes) != 1 || probes[0] != checks[3] {
+		t.Errorf("Expected the probe job check to be returned, got %v", probes)
+	}
+}
@@ -0,0 +1,86 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+// Pipestance lock ownership.
+//
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"syscall"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// Information about the process holding a pipestance lock, stored in the
+// _lock file.
+type LockInfo struct {
+	Hostname string `json:"hostname"`
+	Pid      int    `json:"pid"`
+	User     string `json:"user"`
+	Start    string `json:"start"`
+}
+
+func currentLockInfo() *LockInfo {
+	info := &LockInfo{
+		Pid:   os.Getpid(),
+		Start: util.Timestamp(),
+	}
+	info.Hostname, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		info.User = u.Username
+	}
+	return info
+}
+
+// Parses the content of a lock file.  Lock files written by older versions
+// only contain the time the lock was taken.
+func parseLockInfo(b []byte) *LockInfo {
+	var info LockInfo
+	if err := json.Unmarshal(b, &info); err != nil {
+		info = LockInfo{Start: strings.TrimSpace(string(b))}
+	}
+	return &info
+}
+
+func (self *LockInfo) String() string {
+	var buf strings.Builder
+	if self.User != "" {
+		buf.WriteString(self.User)
+		buf.WriteByte('@')
+	}
+	if self.Hostname != "" {
+		buf.WriteString(self.Hostname)
+	} else {
+		buf.WriteString("an unknown host")
+	}
+	if self.Pid > 0 {
+		fmt.Fprintf(&buf, " (pid %d)", self.Pid)
+	}
+	if self.Start != "" {
+		buf.WriteString(" since ")
+		buf.WriteString(self.Start)
+	}
+	return buf.String()
+}
+
+// Checks whether the lock owner is no longer running.  This can only be
+// verified for owners on the current host.  Returns nil if the owner is
+// known to be dead, or otherwise an error explaining why not.
+func (self *LockInfo) verifyDead() error {
+	if self.Hostname == "" || self.Pid <= 0 {
+		return fmt.Errorf("the lock does not record its owner")
+	}
+	if host, err := os.Hostname(); err != nil || host != self.Hostname {
+		return fmt.Errorf("the owner is on another host, %s", self.Hostname)
+	}
+	if err := syscall.Kill(self.Pid, 0); err != syscall.ESRCH {
+		return fmt.Errorf("process %d is still running", self.Pid)
+	}
+	return nil
+}
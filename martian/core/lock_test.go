@@ -0,0 +1,52 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestParseLockInfo(t *testing.T) {
+	old := parseLockInfo([]byte("2017-08-01 10:00:00\n"))
+	if old.Start != "2017-08-01 10:00:00" || old.Pid != 0 {
+		t.Errorf("Incorrect legacy lock info %v", *old)
+	}
+	if s := old.String(); s != "an unknown host since 2017-08-01 10:00:00" {
+		t.Errorf("Incorrect legacy lock owner %q", s)
+	}
+	b, err := json.Marshal(&LockInfo{
+		Hostname: "node7",
+		Pid:      1234,
+		User:     "jdoe",
+		Start:    "2017-08-01 10:00:00",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := parseLockInfo(b)
+	if s := info.String(); s != "jdoe@node7 (pid 1234) since 2017-08-01 10:00:00" {
+		t.Errorf("Incorrect lock owner %q", s)
+	}
+}
+
+func TestLockInfoVerifyDead(t *testing.T) {
+	info := currentLockInfo()
+	if err := info.verifyDead(); err == nil {
+		t.Error("Current process reported as dead.")
+	}
+	info.Hostname = info.Hostname + ".elsewhere"
+	if err := info.verifyDead(); err == nil {
+		t.Error("Owner on another host reported as dead.")
+	}
+	if host, err := os.Hostname(); err == nil {
+		info.Hostname = host
+		info.Pid = 1 << 22
+		if err := info.verifyDead(); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -5,6 +5,7 @@ package core
 // Martian runtime. This is where the action happens.
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -27,6 +28,7 @@ type MetadataFileName string
 const AnyFile MetadataFileName = "*"
 const (
 	AlarmFile      MetadataFileName = "alarm"
+	BundleFile     MetadataFileName = "bundle"
 	ArgsFile       MetadataFileName = "args"
 	Assert         MetadataFileName = "assert"
 	ChunkDefsFile  MetadataFileName = "chunk_defs"
@@ -34,6 +36,8 @@ const (
 	CompleteFile   MetadataFileName = "complete"
 	Errors         MetadataFileName = "errors"
 	FinalState     MetadataFileName = "finalstate"
+	ForkIndexFile  MetadataFileName = "fork_index"
+	ForkSummary    MetadataFileName = "fork_summary"
 	Heartbeat      MetadataFileName = "heartbeat"
 	InvocationFile MetadataFileName = "invocation"
 	JobId          MetadataFileName = "jobid"
@@ -332,6 +336,7 @@ func (self *Metadata) uniquify() error {
 func (self *Metadata) removeAll() error {
 	self.mutex.Lock()
 	defer self.mutex.Unlock()
+	ioBreaker.forget(self, AnyFile)
 	if len(self.contents) > 0 {
 		self.contents = make(map[MetadataFileName]bool)
 	}
@@ -419,6 +424,14 @@ func (self *Metadata) uncache(name MetadataFileName) {
 	self.mutex.Unlock()
 }
 
+// Drops the parsed content of the given file from the read cache, without
+// forgetting that the file exists.
+func (self *Metadata) uncacheRead(name MetadataFileName) {
+	self.mutex.Lock()
+	delete(self.readCache, name)
+	self.mutex.Unlock()
+}
+
 // Attempt to determine if this metadata object was already
 // uniquified and reset paths appropriately.
 func (self *Metadata) discoverUniquify() {
@@ -482,7 +495,13 @@ func (self *Metadata) exists(name MetadataFileName) bool {
 }
 
 func (self *Metadata) readRawBytes(name MetadataFileName) ([]byte, error) {
-	return ioutil.ReadFile(self.MetadataFilePath(name))
+	var b []byte
+	err := retryIO(func() error {
+		var err error
+		b, err = ioutil.ReadFile(self.MetadataFilePath(name))
+		return err
+	})
+	return b, err
 }
 
 func (self *Metadata) readRawSafe(name MetadataFileName) (string, error) {
@@ -518,35 +537,35 @@ func (self *Metadata) read(name MetadataFileName, limit int64) (LazyArgumentMap,
 		return v, nil
 	}
 	p := self.MetadataFilePath(name)
-	if f, err := os.Open(p); err != nil {
-		if !os.IsNotExist(err) {
+	err := retryIO(func() error {
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if limit > 0 {
+			if info, err := f.Stat(); err != nil {
+				return err
+			} else if info.Size() > limit {
+				return fmt.Errorf(
+					"Insufficient memory to read %s\n"+
+						"File is %d bytes, read size limited to %d bytes.",
+					p, info.Size(), limit)
+			}
+		}
+		v = nil
+		return json.NewDecoder(f).Decode(&v)
+	})
+	if err != nil {
+		if _, ok := err.(*os.PathError); ok && !os.IsNotExist(err) {
 			util.LogError(err, "runtime",
 				"Could not open %s",
 				p)
 		}
 		return nil, err
-	} else {
-		if err := func(p string, f *os.File, limit int64, v *LazyArgumentMap) error {
-			defer f.Close()
-			if limit > 0 {
-				if info, err := f.Stat(); err != nil {
-					return err
-				} else if info.Size() > limit {
-					return fmt.Errorf(
-						"Insufficient memory to read %s\n"+
-							"File is %d bytes, read size limited to %d bytes.",
-						p, info.Size(), limit)
-				}
-			}
-			dec := json.NewDecoder(f)
-			return dec.Decode(v)
-		}(p, f, limit, &v); err == nil {
-			self.saveToCache(name, v)
-			return v, nil
-		} else {
-			return nil, err
-		}
 	}
+	self.saveToCache(name, v)
+	return v, nil
 }
 
 // Reads the content of the given metadata file and deserializes it into
@@ -559,10 +578,21 @@ func (self *Metadata) ReadInto(name MetadataFileName, target interface{}) error
 	}
 }
 
+// Overridden by tests to simulate filesystem failures.
+var writeMetadataFile = ioutil.WriteFile
+
 func (self *Metadata) _writeRawNoLock(name MetadataFileName, text string) error {
-	err := ioutil.WriteFile(self.MetadataFilePath(name), []byte(text), 0644)
-	self._cacheNoLock(name)
-	if err != nil {
+	p := self.MetadataFilePath(name)
+	write := func() error {
+		return writeMetadataFile(p, []byte(text), 0644)
+	}
+	err := retryIO(write)
+	if err == nil {
+		ioBreaker.forget(self, name)
+		self._cacheNoLock(name)
+	} else if isTransientIOError(err) {
+		self.holdWrite(name, err, write)
+	} else {
 		msg := fmt.Sprintf("Could not write %s for %s: %s", name, self.fqname, err.Error())
 		util.LogError(err, "runtime", msg)
 		if name != Errors {
@@ -578,29 +608,105 @@ func (self *Metadata) WriteRaw(name MetadataFileName, text string) error {
 
 // Writes the given raw data into the given metadata file.
 func (self *Metadata) WriteRawBytes(name MetadataFileName, text []byte) error {
-	err := ioutil.WriteFile(self.MetadataFilePath(name), text, 0644)
-	self.cache(name, self.uniquifier)
-	if err != nil {
-		msg := fmt.Sprintf("Could not write %s for %s: %s", name, self.fqname, err.Error())
-		util.LogError(err, "runtime", msg)
-		if name != Errors {
-			self.WriteRaw(Errors, msg)
-		}
+	p := self.MetadataFilePath(name)
+	write := func() error {
+		return writeMetadataFile(p, text, 0644)
 	}
+	err := retryIO(write)
+	self.writeDone(name, err, write)
 	return err
 }
 
-func (self *Metadata) appendRaw(name MetadataFileName, text string) error {
-	self.cache(name, self.uniquifier)
-	if f, err := os.OpenFile(self.MetadataFilePath(name),
-		os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err != nil {
-		return err
-	} else if _, err := f.Write([]byte(text)); err != nil {
-		f.Close()
-		return err
+// Updates the cache after a write, or handles the error if it failed.
+func (self *Metadata) writeDone(name MetadataFileName, err error, write func() error) {
+	if err == nil {
+		ioBreaker.forget(self, name)
+		self.cache(name, self.uniquifier)
+	} else if isTransientIOError(err) {
+		self.holdWrite(name, err, write)
 	} else {
+		self.writeFailed(name, err)
+	}
+}
+
+// Holds a write which failed with a transient error, to be retried once the
+// filesystem recovers, rather than failing the stage.
+func (self *Metadata) holdWrite(name MetadataFileName, err error, write func() error) {
+	util.LogError(err, "runtime", "Could not write %s for %s.  Will retry.",
+		name, self.fqname)
+	ioBreaker.hold(self, name, write)
+}
+
+// Reports a write which failed permanently as an error for the node.
+func (self *Metadata) writeFailed(name MetadataFileName, err error) {
+	msg := fmt.Sprintf("Could not write %s for %s: %s", name, self.fqname, err.Error())
+	util.LogError(err, "runtime", msg)
+	if name != Errors {
+		self.WriteRaw(Errors, msg)
+	}
+}
+
+// The first line of files written by WriteLines.  The trailing space marks
+// the file for adapters as having one element per line, while keeping the
+// file valid json.
+const LinesArrayHeader = "[ \n"
+
+// Serializes an array of count elements, given by elem, to the given
+// metadata file with one element per line, after LinesArrayHeader.  Each
+// element is serialized as it is written, so the entire array is never held
+// in memory in serialized form, and adapters can read the elements one at a
+// time.
+func (self *Metadata) WriteLines(name MetadataFileName, count int,
+	elem func(int) interface{}) error {
+	p := self.MetadataFilePath(name)
+	write := func() error {
+		f, err := os.Create(p)
+		if err != nil {
+			return err
+		}
+		w := bufio.NewWriter(f)
+		w.WriteString(LinesArrayHeader)
+		for i := 0; i < count; i++ {
+			b, err := json.Marshal(elem(i))
+			if err != nil {
+				f.Close()
+				return err
+			}
+			w.Write(b)
+			if i < count-1 {
+				w.WriteString(",\n")
+			} else {
+				w.WriteByte('\n')
+			}
+		}
+		w.WriteString("]\n")
+		if err := w.Flush(); err != nil {
+			f.Close()
+			return err
+		}
 		return f.Close()
 	}
+	err := retryIO(write)
+	self.writeDone(name, err, write)
+	return err
+}
+
+func (self *Metadata) appendRaw(name MetadataFileName, text string) error {
+	err := retryIO(func() error {
+		if f, err := os.OpenFile(self.MetadataFilePath(name),
+			os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+			return err
+		} else if _, err := f.Write([]byte(text)); err != nil {
+			f.Close()
+			return err
+		} else {
+			return f.Close()
+		}
+	})
+	if err == nil {
+		self.cache(name, self.uniquifier)
+	}
+	return err
 }
 
 // Add text to the Alarm file for this node.
@@ -609,7 +715,9 @@ func (self *Metadata) AppendAlarm(text string) error {
 		msg := fmt.Sprintf("Could not write alarm for %s: %s",
 			self.fqname, err.Error())
 		util.LogError(err, "runtime", msg)
-		self.WriteRaw(Errors, msg)
+		if !isTransientIOError(err) {
+			self.WriteRaw(Errors, msg)
+		}
 		return err
 	}
 	if self.journalPrefix != "" {
@@ -641,14 +749,16 @@ func (self *Metadata) WriteAtomic(name MetadataFileName, object interface{}) err
 	}
 	fname := self.MetadataFilePath(name)
 	tmpName := fname + ".tmp"
-	if err := ioutil.WriteFile(tmpName, bytes, 0644); err != nil {
-		return err
-	}
-	if err := os.Rename(tmpName, fname); err == nil || os.IsNotExist(err) {
-		return nil
-	} else {
-		return err
-	}
+	return retryIO(func() error {
+		if err := ioutil.WriteFile(tmpName, bytes, 0644); err != nil {
+			return err
+		}
+		if err := os.Rename(tmpName, fname); err == nil || os.IsNotExist(err) {
+			return nil
+		} else {
+			return err
+		}
+	})
 }
 
 // Writes a journal file corresponding to the given metadata file.  This is
@@ -791,6 +901,41 @@ func (self *Metadata) uncheckedReset() error {
 	}
 }
 
+// Records the time at which the job was submitted to the job manager in the
+// jobinfo file.  This must be called before the job actually starts, since
+// the job itself will update the file once it does.
+func (self *Metadata) recordSubmit(attempt int) {
+	var jobInfo JobInfo
+	if err := self.ReadInto(JobInfoFile, &jobInfo); err != nil {
+		return
+	}
+	jobInfo.Submitted = util.Timestamp()
+	jobInfo.SubmitAttempts = attempt
+	self.Write(JobInfoFile, &jobInfo)
+}
+
+// Returns the total size of the files bound in the given arguments or
+// outputs file.
+func (self *Metadata) boundFileBytes(name MetadataFileName) int64 {
+	var args LazyArgumentMap
+	if err := self.ReadInto(name, &args); err != nil {
+		return 0
+	}
+	return boundFileBytes(args)
+}
+
+// Records the total size of the files bound to the outputs of a completed
+// job in the jobinfo file.  This must be called before volatile data
+// removal might delete them.
+func (self *Metadata) recordOutputBytes() {
+	var jobInfo JobInfo
+	if err := self.ReadInto(JobInfoFile, &jobInfo); err != nil {
+		return
+	}
+	jobInfo.BoundOutputBytes = self.boundFileBytes(OutsFile)
+	self.Write(JobInfoFile, &jobInfo)
+}
+
 // Resets the metadata if the state was queued, but the job manager had not yet
 // started the job locally or queued it remotely.
 func (self *Metadata) restartQueuedLocal() error {
@@ -0,0 +1,47 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestWriteLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestWriteLines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	metadata := NewMetadata("ID.test.STAGE", dir)
+	outs := []LazyArgumentMap{
+		{"sum": json.RawMessage(`{
+    "a": 1
+}`)},
+		{"sum": json.RawMessage(`2`)},
+	}
+	if err := metadata.WriteLines(ChunkOutsFile, len(outs),
+		func(i int) interface{} { return outs[i] }); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(metadata.MetadataFilePath(ChunkOutsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != "[ \n{\"sum\":{\"a\":1}},\n{\"sum\":2}\n]\n" {
+		t.Errorf("Incorrect content %q", s)
+	}
+	if err := metadata.WriteLines(ChunkDefsFile, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	var defs []interface{}
+	if err := metadata.ReadInto(ChunkDefsFile, &defs); err != nil {
+		t.Error(err)
+	} else if defs == nil || len(defs) != 0 {
+		t.Errorf("Expected an empty array, got %v", defs)
+	}
+}
@@ -0,0 +1,58 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+// Pinning the pipeline version required by an invocation.
+//
+// An invocation may require a particular version of the pipelines with a
+// comment line of the form
+//
+//     # @mro_version v2.3.0
+//
+// The pin is matched against the version found for MROPATH, or, if it
+// looks like a git commit hash, against the commit checked out in any of
+// the MROPATH directories, which must not have uncommitted changes.
+//
+
+package core
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+var (
+	mroPinRe    = regexp.MustCompile(`(?m)^[ \t]*#[ \t]*@mro_version[ \t]+(\S+)[ \t]*$`)
+	gitCommitRe = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+)
+
+// Returns the pipeline version pinned in the invocation source, if any.
+func getMroPin(src string) string {
+	if m := mroPinRe.FindStringSubmatch(src); len(m) > 1 {
+		return m[1]
+	}
+	return ""
+}
+
+// Returns an error if the invocation source pins a pipeline version which
+// does not match the pipelines in mroPaths.
+func checkMroPin(src string, mroPaths []string, mroVersion string) error {
+	pin := getMroPin(src)
+	if pin == "" || pin == mroVersion {
+		return nil
+	}
+	if gitCommitRe.MatchString(pin) {
+		for _, dir := range mroPaths {
+			commit, err := util.GetGitCommit(dir)
+			if err != nil || !strings.HasPrefix(commit, pin) {
+				continue
+			}
+			if tag, err := util.GetGitTag(dir); err == nil &&
+				!strings.HasSuffix(tag, "-dirty") {
+				return nil
+			}
+		}
+	}
+	return &PipelineVersionError{Pinned: pin, Found: mroVersion}
+}
@@ -0,0 +1,36 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+
+package core
+
+import (
+	"testing"
+)
+
+func TestCheckMroPin(t *testing.T) {
+	src := `@include "pipeline.mro"
+
+  # @mro_version v2.3.0
+call PIPELINE(
+    sample = "x",
+)
+`
+	if pin := getMroPin(src); pin != "v2.3.0" {
+		t.Errorf("Expected pin v2.3.0, got %q", pin)
+	}
+	if err := checkMroPin(src, nil, "v2.3.0"); err != nil {
+		t.Error(err)
+	}
+	if err := checkMroPin(src, nil, "v2.3.1"); err == nil {
+		t.Error("Expected an error for a mismatched version.")
+	} else if _, ok := err.(*PipelineVersionError); !ok {
+		t.Errorf("Incorrect error type %T", err)
+	}
+	if err := checkMroPin(`call PIPELINE()`, nil, "v2.3.1"); err != nil {
+		t.Error(err)
+	}
+	if pin := getMroPin(`# @mro_versions v1`); pin != "" {
+		t.Errorf("Unexpected pin %q", pin)
+	}
+}
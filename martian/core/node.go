@@ -59,6 +59,7 @@ type Node struct {
 	metadata           *Metadata
 	callable           syntax.Callable
 	resources          *JobResources
+	wallTimeHours      int
 	argbindings        map[string]*Binding
 	argbindingList     []*Binding // for stable ordering
 	retbindings        map[string]*Binding
@@ -334,9 +335,38 @@ func (self *Node) mkdirs() error {
 		}(fork)
 	}
 	wg.Wait()
+	if len(self.forks) > 1 {
+		self.writeForkIndex()
+	}
 	return nil
 }
 
+// Writes a file mapping each fork's directory to its sweep values, so that
+// users don't need to infer it from the fork index.
+func (self *Node) writeForkIndex() {
+	index := make([]*ForkIndexEntry, len(self.forks))
+	for i, fork := range self.forks {
+		index[i] = &ForkIndexEntry{
+			Index: fork.index,
+			Id:    fork.id,
+			Args:  fork.argPermute,
+		}
+	}
+	self.metadata.Write(ForkIndexFile, index)
+}
+
+// Collects the sweep values, state, and outputs of each fork.
+func (self *Node) summarizeForks() *NodeForkSummary {
+	summary := &NodeForkSummary{
+		Fqname: self.fqname,
+		Forks:  make([]*ForkSummaryInfo, len(self.forks)),
+	}
+	for i, fork := range self.forks {
+		summary.Forks[i] = fork.summarize()
+	}
+	return summary
+}
+
 //
 // Sweep management
 //
@@ -560,9 +590,17 @@ func (self *Node) removeMetadata() {
 	}
 }
 
-func (self *Node) getFork(index int) *Fork {
-	if index < len(self.forks) {
-		return self.forks[index]
+// Get the fork with the given directory name, e.g. fork0.
+func (self *Node) getFork(id string) *Fork {
+	if index, err := strconv.Atoi(strings.TrimPrefix(id, "fork")); err == nil {
+		if index >= 0 && index < len(self.forks) && self.forks[index].id == id {
+			return self.forks[index]
+		}
+	}
+	for _, fork := range self.forks {
+		if fork.id == id {
+			return fork
+		}
 	}
 	return nil
 }
@@ -786,6 +824,9 @@ func (self *Node) step() bool {
 		}
 		self.addFrontierNode(self)
 	case Complete:
+		if self.state != previousState && len(self.forks) > 1 {
+			self.metadata.Write(ForkSummary, self.summarizeForks())
+		}
 		if self.rt.Config.VdrMode == "rolling" {
 			for _, node := range self.prenodes {
 				node.getNode().vdrKill()
@@ -809,22 +850,21 @@ func (self *Node) step() bool {
 // Regular expression to convert a fully qualified name for a chunk into the
 // component parts of the pipeline path.  The parts are:
 // 1. The fully qualified stage name.
-// 2. The fork index.
+// 2. The fork ID, either fork<index> or a stable fork ID.
 // 3. The chunk index, if any.
 // 4. The job uniquifier, if any.
 // 5. The metadata file name.
-var jobJournalRe = regexp.MustCompile(`(.*)\.fork(\d+)(?:\.chnk(\d+))?(?:\.u([a-f0-9]{10}))?\.(.*)$`)
+var jobJournalRe = regexp.MustCompile(`(.*)\.(fork(?:\d+|_[a-f0-9]{12}))(?:\.chnk(\d+))?(?:\.u([a-f0-9]{10}))?\.(.*)$`)
 
-func (self *Node) parseRunFilename(fqname string) (string, int, int, string, string) {
+func (self *Node) parseRunFilename(fqname string) (string, string, int, string, string) {
 	if match := jobJournalRe.FindStringSubmatch(fqname); match != nil {
-		forkIndex, _ := strconv.Atoi(match[2])
 		chunkIndex := -1
 		if match[3] != "" {
 			chunkIndex, _ = strconv.Atoi(match[3])
 		}
-		return match[1], forkIndex, chunkIndex, match[4], match[5]
+		return match[1], match[2], chunkIndex, match[4], match[5]
 	}
-	return "", -1, -1, "", ""
+	return "", "", -1, "", ""
 }
 
 func (self *Node) refreshState(readOnly bool) {
@@ -837,9 +877,9 @@ func (self *Node) refreshState(readOnly bool) {
 			continue
 		}
 
-		fqname, forkIndex, chunkIndex, uniquifier, state := self.parseRunFilename(filename)
+		fqname, forkId, chunkIndex, uniquifier, state := self.parseRunFilename(filename)
 		if node := self.find(fqname); node != nil {
-			if fork := node.getFork(forkIndex); fork != nil {
+			if fork := node.getFork(forkId); fork != nil {
 				if chunkIndex >= 0 {
 					if chunk := fork.getChunk(chunkIndex); chunk != nil {
 						chunk.updateState(MetadataFileName(state), uniquifier)
@@ -982,6 +1022,17 @@ func (self *Node) getJobReqs(jobDef *JobResources, stageType string) (int, int,
 			self.fqname, stageType, overrideMem)
 	}
 
+	overrideSpecial := self.rt.overrides.GetOverride(self,
+		fmt.Sprintf("%s.special", stageType),
+		special)
+	if overrideSpecialStr, ok := overrideSpecial.(string); ok {
+		special = overrideSpecialStr
+	} else {
+		util.PrintInfo("runtime",
+			"Invalid value for %s %s.special: %v",
+			self.fqname, stageType, overrideSpecial)
+	}
+
 	if self.local {
 		threads, memGB = self.rt.LocalJobManager.GetSystemReqs(threads, memGB)
 	} else {
@@ -992,6 +1043,33 @@ func (self *Node) getJobReqs(jobDef *JobResources, stageType string) (int, int,
 	return threads, memGB, special
 }
 
+// Get the walltime limit, in hours, for jobs of the given type.  The default
+// comes from the stage's using() block, or if that does not set one from the
+// job manager settings, and can be changed through the overrides file.
+func (self *Node) getWallTime(stageType string) int {
+	walltime := 0
+	if self.wallTimeHours > 0 {
+		walltime = self.wallTimeHours
+	} else if self.local {
+		walltime = self.rt.LocalJobManager.GetSettings().WallTimeHours
+	} else {
+		walltime = self.rt.JobManager.GetSettings().WallTimeHours
+	}
+	override := self.rt.overrides.GetOverride(self,
+		fmt.Sprintf("%s.walltime_hours", stageType),
+		float64(walltime))
+	if overrideNum, ok := override.(float64); ok {
+		// Round up, since a fractional limit should not become zero, which
+		// means no limit at all.
+		walltime = int(math.Ceil(overrideNum))
+	} else {
+		util.PrintInfo("runtime",
+			"Invalid value for %s %s.walltime_hours: %v",
+			self.fqname, stageType, override)
+	}
+	return walltime
+}
+
 func (self *Node) getProfileMode(stageType string) ProfileMode {
 	p := self.rt.overrides.GetOverride(self,
 		fmt.Sprintf("%s.profile", stageType),
@@ -1126,6 +1204,7 @@ func (self *Node) runJob(shellName string, fqname, stageType string, metadata *M
 			path.Base(jobModeLabel), padding, fqname, shellName)
 	}
 	profileMode := self.getProfileMode(stageType)
+	walltime := self.getWallTime(stageType)
 	jobInfo := JobInfo{
 		Name:          fqname,
 		Type:          jobMode,
@@ -1137,6 +1216,10 @@ func (self *Node) runJob(shellName string, fqname, stageType string, metadata *M
 		Monitor:       monitor,
 		Invocation:    self.invocation,
 		Version:       version,
+		Queued:        util.Timestamp(),
+		WallTimeHours: walltime,
+
+		BoundInputBytes: metadata.boundFileBytes(ArgsFile),
 	}
 	if jobInfo.ProfileConfig != nil && jobInfo.ProfileConfig.Adapter != "" {
 		jobInfo.ProfileMode = jobInfo.ProfileConfig.Adapter
@@ -1148,6 +1231,6 @@ func (self *Node) runJob(shellName string, fqname, stageType string, metadata *M
 		metadata.WriteTime(QueuedLocally)
 		metadata.Write(JobInfoFile, &jobInfo)
 	}()
-	jobManager.execJob(shellCmd, argv, envs, metadata, threads, memGB, special, fqname,
-		shellName, self.preflight && self.local)
+	jobManager.execJob(shellCmd, argv, envs, metadata, threads, memGB, walltime,
+		special, fqname, shellName, self.preflight && self.local)
 }
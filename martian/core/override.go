@@ -62,16 +62,22 @@ type PipestanceOverrides struct {
 // Specifies the expected types for elements in a stageoverride map. Note that
 // all JSON numeric types look like Float64s when we stick them in an interface.
 var LegalOverrideTypes map[string]reflect.Kind = map[string]reflect.Kind{
-	"force_volatile": reflect.Bool,
-	"join.threads":   reflect.Float64,
-	"join.mem_gb":    reflect.Float64,
-	"join.profile":   reflect.String,
-	"chunk.threads":  reflect.Float64,
-	"chunk.mem_gb":   reflect.Float64,
-	"chunk.profile":  reflect.String,
-	"split.threads":  reflect.Float64,
-	"split.mem_gb":   reflect.Float64,
-	"split.profile":  reflect.String,
+	"force_volatile":       reflect.Bool,
+	"join.threads":         reflect.Float64,
+	"join.mem_gb":          reflect.Float64,
+	"join.profile":         reflect.String,
+	"join.special":         reflect.String,
+	"join.walltime_hours":  reflect.Float64,
+	"chunk.threads":        reflect.Float64,
+	"chunk.mem_gb":         reflect.Float64,
+	"chunk.profile":        reflect.String,
+	"chunk.special":        reflect.String,
+	"chunk.walltime_hours": reflect.Float64,
+	"split.threads":        reflect.Float64,
+	"split.mem_gb":         reflect.Float64,
+	"split.profile":        reflect.String,
+	"split.special":        reflect.String,
+	"split.walltime_hours": reflect.Float64,
 }
 
 // Read the overrides file and produce a pipestance overrides object.
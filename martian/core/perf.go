@@ -9,8 +9,11 @@ package core
 // - Get arguments and compute file sizes (if they exist)
 
 import (
+	"encoding/json"
 	"github.com/martian-lang/martian/martian/util"
 	"math"
+	"os"
+	"path"
 	"time"
 )
 
@@ -146,6 +149,22 @@ type PerfInfo struct {
 	// For node aggregates, it's the deviation between child nodes.
 	InBytesDev  float64 `json:"in_bytes_dev"`
 	OutBytesDev float64 `json:"out_bytes_dev"`
+
+	// QueueWait is the time between submission to the job manager and the
+	// start of the job, and SubmitDelay is the time mrp held the job before
+	// submitting it.  For node aggregates, these are the maximum over jobs.
+	QueueWait     float64 `json:"queue_wait,omitempty"`
+	SubmitDelay   float64 `json:"submit_delay,omitempty"`
+	SubmitRetries int     `json:"submit_retries,omitempty"`
+
+	// The memory reserved by jobs, times their duration.
+	MemGBHours float64 `json:"mem_gb_hours,omitempty"`
+
+	// The total size of the files bound to job arguments and outputs.
+	// Stages which read or write much more than they compute may be worth
+	// optimizing.
+	BoundInputBytes  int64 `json:"bound_input_bytes,omitempty"`
+	BoundOutputBytes int64 `json:"bound_output_bytes,omitempty"`
 }
 
 type PerfInfoByStart []*PerfInfo
@@ -196,6 +215,7 @@ type NodePerfInfo struct {
 	MaxBytes  int64            `json:"maxbytes"`
 	BytesHist []*NodeByteStamp `json:"bytehist"`
 	HighMem   *ObservedMemory  `json:"highmem,omitempty"`
+	Cost      *CostEstimate    `json:"cost,omitempty"`
 }
 
 func reduceJobInfo(jobInfo *JobInfo, outputPaths []string, numThreads int) *PerfInfo {
@@ -204,17 +224,33 @@ func reduceJobInfo(jobInfo *JobInfo, outputPaths []string, numThreads int) *Perf
 
 	perfInfo.NumJobs = 1
 	perfInfo.NumThreads = numThreads
+	if jobInfo.SubmitAttempts > 1 {
+		perfInfo.SubmitRetries = jobInfo.SubmitAttempts - 1
+	}
 	if jobInfo.WallClockInfo != nil {
 		perfInfo.Start, _ = time.Parse(timeLayout, jobInfo.WallClockInfo.Start)
 		perfInfo.End, _ = time.Parse(timeLayout, jobInfo.WallClockInfo.End)
 		perfInfo.Duration = jobInfo.WallClockInfo.Duration
 		perfInfo.WallTime = perfInfo.End.Sub(perfInfo.Start).Seconds()
+		queued, qerr := time.Parse(timeLayout, jobInfo.Queued)
+		submitted, err := time.Parse(timeLayout, jobInfo.Submitted)
+		if err != nil {
+			// Jobs queued by older versions of mrp don't record a
+			// submission time.
+			submitted, err = queued, qerr
+		} else if qerr == nil && submitted.After(queued) {
+			perfInfo.SubmitDelay = submitted.Sub(queued).Seconds()
+		}
+		if err == nil && !perfInfo.Start.IsZero() && perfInfo.Start.After(submitted) {
+			perfInfo.QueueWait = perfInfo.Start.Sub(submitted).Seconds()
+		}
 	}
 	if jobInfo.RusageInfo != nil {
 		self := jobInfo.RusageInfo.Self
 		children := jobInfo.RusageInfo.Children
 
 		perfInfo.CoreHours = float64(perfInfo.NumThreads) * perfInfo.Duration / 3600.0
+		perfInfo.MemGBHours = float64(jobInfo.MemGB) * perfInfo.Duration / 3600.0
 		perfInfo.MaxRss = max(self.MaxRss, children.MaxRss)
 		perfInfo.InBlocks = self.InBlocks + children.InBlocks
 		perfInfo.OutBlocks = self.OutBlocks + children.OutBlocks
@@ -246,6 +282,9 @@ func reduceJobInfo(jobInfo *JobInfo, outputPaths []string, numThreads int) *Perf
 		perfInfo.OutBytesDev = jobInfo.IoStats.RateDev.Write.BlockBytes
 	}
 
+	perfInfo.BoundInputBytes = jobInfo.BoundInputBytes
+	perfInfo.BoundOutputBytes = jobInfo.BoundOutputBytes
+
 	perfInfo.OutputFiles, perfInfo.OutputBytes = util.GetDirectorySize(outputPaths)
 	perfInfo.TotalFiles = perfInfo.OutputFiles
 	perfInfo.TotalBytes = perfInfo.OutputBytes
@@ -253,6 +292,39 @@ func reduceJobInfo(jobInfo *JobInfo, outputPaths []string, numThreads int) *Perf
 	return &perfInfo
 }
 
+// Returns the total size of the regular files named by absolute paths in a
+// set of arguments or outputs.  Directories are not counted, since walking
+// large reference directories can be slow.
+func boundFileBytes(args LazyArgumentMap) int64 {
+	var size int64
+	var addFiles func(interface{})
+	addFiles = func(v interface{}) {
+		switch v := v.(type) {
+		case string:
+			if path.IsAbs(v) {
+				if info, err := os.Stat(v); err == nil && info.Mode().IsRegular() {
+					size += info.Size()
+				}
+			}
+		case []interface{}:
+			for _, e := range v {
+				addFiles(e)
+			}
+		case map[string]interface{}:
+			for _, e := range v {
+				addFiles(e)
+			}
+		}
+	}
+	for _, raw := range args {
+		var v interface{}
+		if json.Unmarshal(raw, &v) == nil {
+			addFiles(v)
+		}
+	}
+	return size
+}
+
 func ComputeStats(perfInfos []*PerfInfo, outputPaths []string, vdrKillReport *VDRKillReport) *PerfInfo {
 	aggPerfInfo := &PerfInfo{}
 	fmax := func(x, y float64) float64 {
@@ -290,6 +362,12 @@ func ComputeStats(perfInfos []*PerfInfo, outputPaths []string, vdrKillReport *VD
 		aggPerfInfo.OutputBytes += perfInfo.OutputBytes
 		aggPerfInfo.UserTime += perfInfo.UserTime
 		aggPerfInfo.SystemTime += perfInfo.SystemTime
+		aggPerfInfo.QueueWait = fmax(aggPerfInfo.QueueWait, perfInfo.QueueWait)
+		aggPerfInfo.SubmitDelay = fmax(aggPerfInfo.SubmitDelay, perfInfo.SubmitDelay)
+		aggPerfInfo.SubmitRetries += perfInfo.SubmitRetries
+		aggPerfInfo.MemGBHours += perfInfo.MemGBHours
+		aggPerfInfo.BoundInputBytes += perfInfo.BoundInputBytes
+		aggPerfInfo.BoundOutputBytes += perfInfo.BoundOutputBytes
 
 		if perfInfo.Duration > 0 {
 			// Accumulate sum^2 bytes here.  Convert to deviation at the end.
@@ -0,0 +1,108 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestReduceJobInfoQueueWait(t *testing.T) {
+	info := JobInfo{
+		Queued:         "2017-01-01 10:00:00",
+		Submitted:      "2017-01-01 10:00:30",
+		SubmitAttempts: 3,
+		WallClockInfo: &WallClockInfo{
+			Start: "2017-01-01 10:02:30",
+			End:   "2017-01-01 10:05:30",
+		},
+	}
+	perf := reduceJobInfo(&info, nil, 1)
+	if perf.SubmitDelay != 30 {
+		t.Errorf("Expected 30s submit delay, got %g", perf.SubmitDelay)
+	}
+	if perf.QueueWait != 120 {
+		t.Errorf("Expected 120s queue wait, got %g", perf.QueueWait)
+	}
+	if perf.SubmitRetries != 2 {
+		t.Errorf("Expected 2 retries, got %d", perf.SubmitRetries)
+	}
+
+	// Older jobinfo files don't have a submit time.
+	info.Submitted = ""
+	info.SubmitAttempts = 0
+	perf = reduceJobInfo(&info, nil, 1)
+	if perf.SubmitDelay != 0 {
+		t.Errorf("Expected no submit delay, got %g", perf.SubmitDelay)
+	}
+	if perf.QueueWait != 150 {
+		t.Errorf("Expected 150s queue wait, got %g", perf.QueueWait)
+	}
+}
+
+func TestPriceTableEstimate(t *testing.T) {
+	prices := PriceTable{
+		CoreHour:       0.5,
+		MemGBHour:      0.25,
+		StorageGBMonth: 2,
+		StorageMonths:  3,
+	}
+	cost := prices.Estimate(&PerfInfo{
+		CoreHours:   4,
+		MemGBHours:  8,
+		OutputBytes: 1024 * 1024 * 1024,
+	})
+	if cost.Compute != 2 {
+		t.Errorf("Expected compute cost 2, got %g", cost.Compute)
+	}
+	if cost.Memory != 2 {
+		t.Errorf("Expected memory cost 2, got %g", cost.Memory)
+	}
+	if cost.Storage != 6 {
+		t.Errorf("Expected storage cost 6, got %g", cost.Storage)
+	}
+	if cost.Total != 10 {
+		t.Errorf("Expected total cost 10, got %g", cost.Total)
+	}
+}
+
+func TestBoundFileBytes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestBoundFileBytes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a, b := path.Join(dir, "a.txt"), path.Join(dir, "b.txt")
+	if err := ioutil.WriteFile(a, make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(b, make([]byte, 20), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var args LazyArgumentMap
+	if err := json.Unmarshal([]byte(`{
+		"file": "`+a+`",
+		"files": ["`+b+`", "relative.txt", "`+path.Join(dir, "missing")+`"],
+		"nested": {"dir": "`+dir+`", "file": "`+b+`"},
+		"count": 3
+	}`), &args); err != nil {
+		t.Fatal(err)
+	}
+	if size := boundFileBytes(args); size != 140 {
+		t.Errorf("Expected 140 bytes, got %d", size)
+	}
+
+	perf := ComputeStats([]*PerfInfo{
+		reduceJobInfo(&JobInfo{BoundInputBytes: 140, BoundOutputBytes: 20}, nil, 1),
+		reduceJobInfo(&JobInfo{BoundInputBytes: 10}, nil, 1),
+	}, nil, nil)
+	if perf.BoundInputBytes != 150 || perf.BoundOutputBytes != 20 {
+		t.Errorf("Expected 150 input and 20 output bytes, got %d and %d",
+			perf.BoundInputBytes, perf.BoundOutputBytes)
+	}
+}
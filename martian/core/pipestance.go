@@ -14,6 +14,7 @@ import (
 	"path"
 	"path/filepath"
 	"runtime/trace"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
@@ -69,6 +70,7 @@ func NewStagestance(parent Nodable, callStm *syntax.CallStm, callables *syntax.C
 			Special: stage.Resources.Special,
 		}
 		self.node.strictVolatile = stage.Resources.StrictVolatile
+		self.node.wallTimeHours = int(stage.Resources.WallTimeHours)
 	}
 	self.node.buildForks(self.node.argbindingList)
 	if stage.Retain != nil {
@@ -134,6 +136,10 @@ type Pipestance struct {
 	metadata *Metadata
 	uuid     string
 
+	// True if the pipestance was opened without taking the lock, for
+	// example to observe a pipestance being run by another mrp process.
+	inspectOnly bool
+
 	// Cache for self.node.allNodes()
 	allNodesCache    []*Node
 	queueCheckLock   sync.Mutex
@@ -304,7 +310,9 @@ func (self *Pipestance) RefreshState(ctx context.Context) {
 	defer r.End()
 	self.node.refreshState(self.readOnly())
 }
-func (self *Pipestance) readOnly() bool { return !self.metadata.exists(Lock) }
+func (self *Pipestance) readOnly() bool {
+	return self.inspectOnly || !self.metadata.exists(Lock)
+}
 
 func (self *Pipestance) GetPrenodes() map[string]Nodable {
 	return self.node.GetPrenodes()
@@ -386,10 +394,54 @@ func (self *Pipestance) KillWithMessage(message string) {
 	if self.readOnly() {
 		return
 	}
+	var jobs map[string]*Metadata
+	if self.node.rt != nil && self.node.rt.JobManager != nil {
+		jobs = self.queuedJobIds()
+	}
 	nodes := self.node.getFrontierNodes()
 	for _, node := range nodes {
 		node.kill(message)
 	}
+	if len(jobs) > 0 {
+		self.killJobs(jobs)
+	}
+}
+
+// Cancel the given cluster jobs, and check that the job manager no longer
+// knows about them, if it is able to.
+func (self *Pipestance) killJobs(jobs map[string]*Metadata) {
+	jobManager := self.node.rt.JobManager
+	if !jobManager.canKillJobs() {
+		return
+	}
+	ids := make([]string, 0, len(jobs))
+	for id := range jobs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	util.PrintInfo("runtime", "Cancelling %d cluster jobs.", len(ids))
+	if err := jobManager.killJobs(ids, ctx); err != nil {
+		util.PrintError(err, "runtime", "Error cancelling cluster jobs.")
+		return
+	}
+	if !jobManager.hasQueueCheck() {
+		return
+	}
+	if remaining, raw := jobManager.checkQueue(ids, ctx); len(remaining) > 0 {
+		stillQueued := make([]string, 0, len(remaining))
+		for _, id := range remaining {
+			if _, ok := jobs[id]; ok {
+				stillQueued = append(stillQueued, id)
+			}
+		}
+		if len(stillQueued) > 0 {
+			util.PrintInfo("runtime",
+				"Cluster jobs still queued or running after cancellation: %s\n%s",
+				strings.Join(stillQueued, ", "), raw)
+		}
+	}
 }
 
 func (self *Pipestance) RestartRunningNodes(jobMode string, outerCtx context.Context) error {
@@ -447,6 +499,16 @@ func (self *Pipestance) CheckHeartbeats(ctx context.Context) {
 	if self.readOnly() {
 		return
 	}
+	if ioBreaker.isOpen() {
+		// Heartbeats may be missing because the filesystem is unavailable,
+		// so restart the timeout once it recovers.
+		for _, node := range self.node.getFrontierNodes() {
+			for _, m := range node.collectMetadatas() {
+				m.resetHeartbeat()
+			}
+		}
+		return
+	}
 	self.queryQueue(ctx)
 
 	nodes := self.node.getFrontierNodes()
@@ -455,6 +517,49 @@ func (self *Pipestance) CheckHeartbeats(ctx context.Context) {
 	}
 }
 
+// Gets the most recent time a heartbeat was seen from a running job, as of
+// the last call to CheckHeartbeats, and the fqnames of the nodes which are
+// queued or running.
+func (self *Pipestance) GetActivity() (time.Time, []string) {
+	var last time.Time
+	var active []string
+	for _, node := range self.node.getFrontierNodes() {
+		switch node.getState() {
+		case Queued, Running:
+			active = append(active, node.fqname)
+		}
+		for _, m := range node.collectMetadatas() {
+			if m.lastHeartbeat.After(last) {
+				last = m.lastHeartbeat
+			}
+		}
+	}
+	return last, active
+}
+
+// Get the job IDs of all queued or running jobs, mapped to their metadata.
+func (self *Pipestance) queuedJobIds() map[string]*Metadata {
+	jobs := make(map[string]*Metadata)
+	metas := make(map[*Metadata]bool) // avoid double-reading any metadatas
+	nodes := self.node.getFrontierNodes()
+	for _, node := range nodes {
+		for _, m := range node.collectMetadatas() {
+			if !metas[m] {
+				if st, ok := m.getState(); ok &&
+					(st == Queued || st == Running) &&
+					m.exists(JobId) {
+					metas[m] = true
+					id := m.readRaw(JobId)
+					if id != "" {
+						jobs[id] = m
+					}
+				}
+			}
+		}
+	}
+	return jobs
+}
+
 // Check that the queued jobs are actually queued.
 func (self *Pipestance) queryQueue(outerCtx context.Context) {
 	prepDone := false
@@ -480,26 +585,7 @@ func (self *Pipestance) queryQueue(outerCtx context.Context) {
 	}
 	// Get the jobids which need to be queried, and the metadatas which need to
 	// be poked if they're not in the queue.
-	needsQuery := make(map[string]*Metadata)
-	{
-		metas := make(map[*Metadata]bool) // avoid double-reading any metadatas
-		nodes := self.node.getFrontierNodes()
-		for _, node := range nodes {
-			for _, m := range node.collectMetadatas() {
-				if !metas[m] {
-					if st, ok := m.getState(); ok &&
-						(st == Queued || st == Running) &&
-						m.exists(JobId) {
-						metas[m] = true
-						id := m.readRaw(JobId)
-						if id != "" {
-							needsQuery[id] = m
-						}
-					}
-				}
-			}
-		}
-	}
+	needsQuery := self.queuedJobIds()
 	if len(needsQuery) == 0 {
 		self.queueCheckLock.Lock()
 		self.queueCheckActive = false
@@ -582,6 +668,13 @@ func (self *Pipestance) StepNodes(ctx context.Context) bool {
 	if self.readOnly() {
 		return false
 	}
+	if ioBreaker.isOpen() {
+		util.LogInfo("runtime", "Waiting for metadata I/O to recover.")
+		return false
+	}
+	if !ioBreaker.flush() {
+		return false
+	}
 	if err := CheckMinimalSpace(self.node.path); err != nil {
 		if _, ok := err.(*DiskSpaceError); ok {
 			util.PrintError(err, "runtime",
@@ -639,8 +732,10 @@ func (self *Pipestance) SerializeState() []*NodeInfo {
 func (self *Pipestance) SerializePerf() []*NodePerfInfo {
 	nodes := self.allNodes()
 	ser := make([]*NodePerfInfo, 0, len(nodes))
+	prices := self.node.rt.Config.PriceTable
 	for _, node := range nodes {
 		perf, _ := node.serializePerf()
+		perf.Cost = prices.estimateNode(perf)
 		ser = append(ser, perf)
 	}
 	util.LogInfo("perform", "Serializing pipestance performance data.")
@@ -652,6 +747,28 @@ func (self *Pipestance) SerializePerf() []*NodePerfInfo {
 	return ser
 }
 
+// Gets the summaries of the forks of the given node, or of every node with
+// more than one fork if fqname is empty.  Returns nil if the node does not
+// exist.
+func (self *Pipestance) GetForkSummaries(fqname string) []*NodeForkSummary {
+	if fqname != "" {
+		if node := self.node.find(fqname); node != nil {
+			return []*NodeForkSummary{node.summarizeForks()}
+		}
+		return nil
+	}
+	var result []*NodeForkSummary
+	for _, node := range self.allNodes() {
+		if len(node.forks) > 1 {
+			result = append(result, node.summarizeForks())
+		}
+	}
+	if result == nil {
+		result = []*NodeForkSummary{}
+	}
+	return result
+}
+
 func (self *Pipestance) Serialize(name MetadataFileName) interface{} {
 	switch name {
 	case FinalState:
@@ -746,10 +863,25 @@ func (self *Pipestance) GetPath() string {
 	return self.node.parent.getNode().path
 }
 
+func (self *Pipestance) GetMroPaths() []string {
+	return self.node.mroPaths
+}
+
 func (self *Pipestance) GetInvocation() interface{} {
 	return self.node.parent.getNode().invocation
 }
 
+// Replaces the invocation source and preprocessed mro source which the
+// pipestance was started with.  The caller must check that the new call is
+// equivalent to the old one, since the outputs of completed stages are
+// reused when the pipestance is restarted.
+func (self *Pipestance) UpdateInvocation(src, postsrc string) error {
+	if err := self.metadata.WriteRaw(InvocationFile, src); err != nil {
+		return err
+	}
+	return self.metadata.WriteRaw(MroSourceFile, postsrc)
+}
+
 func (self *Pipestance) VerifyJobMode() error {
 	self.metadata.loadCache()
 	if self.metadata.exists(JobModeFile) {
@@ -832,14 +964,34 @@ func (self *Pipestance) SetUuid(uuid string) error {
 func (self *Pipestance) Lock() error {
 	self.metadata.loadCache()
 	if self.metadata.exists(Lock) {
-		return &PipestanceLockedError{self.node.parent.getNode().name, self.GetPath()}
+		var owner *LockInfo
+		if b, err := self.metadata.readRawBytes(Lock); err == nil {
+			owner = parseLockInfo(b)
+		}
+		lockErr := &PipestanceLockedError{
+			Psid:           self.node.parent.getNode().name,
+			PipestancePath: self.GetPath(),
+			Owner:          owner,
+		}
+		if !self.node.rt.Config.ForceTakeover || owner == nil {
+			return lockErr
+		}
+		if err := owner.verifyDead(); err != nil {
+			lockErr.TakeoverError = err
+			return lockErr
+		}
+		util.PrintInfo("runtime", "Taking over lock held by %s.", owner)
 	}
 	util.RegisterSignalHandler(self)
-	self.metadata.WriteTime(Lock)
+	self.metadata.Write(Lock, currentLockInfo())
 	return nil
 }
 
 func (self *Pipestance) unlock() {
+	if self.inspectOnly {
+		// The lock, if any, belongs to another process.
+		return
+	}
 	self.metadata.remove(Lock)
 }
 
@@ -943,6 +1095,9 @@ func NewTopNode(rt *Runtime, psid string, p string, mroPaths []string, mroVersio
 type PipestanceFactory interface {
 	ReattachToPipestance(ctx context.Context) (*Pipestance, error)
 	InvokePipeline() (*Pipestance, error)
+
+	// Returns a copy of the factory which uses the given invocation source.
+	WithInvocation(src string) PipestanceFactory
 }
 
 type runtimePipeFactory struct {
@@ -983,6 +1138,11 @@ func (self runtimePipeFactory) ReattachToPipestance(ctx context.Context) (*Pipes
 		self.checkSrc, self.readOnly, ctx)
 }
 
+func (self runtimePipeFactory) WithInvocation(src string) PipestanceFactory {
+	self.invocationSrc = src
+	return self
+}
+
 func (self runtimePipeFactory) InvokePipeline() (*Pipestance, error) {
 	return self.rt.InvokePipeline(self.invocationSrc, self.invocationPath, self.psid,
 		self.pipestancePath, self.mroPaths, self.mroVersion, self.envs, self.tags)
@@ -8,6 +8,7 @@ package core // import "github.com/martian-lang/martian/martian/core"
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -169,6 +170,21 @@ type RuntimeOptions struct {
 	Overrides       *PipestanceOverrides
 	LimitLoadavg    bool
 	NeverLocal      bool
+
+	// Name fork directories by a hash of their sweep values rather than
+	// by index.
+	StableForkIds bool
+
+	// Prices used to estimate the cost of the pipestance in its
+	// performance data.
+	PriceTable *PriceTable
+
+	// Take over the pipestance lock if the process which holds it is no
+	// longer running.
+	ForceTakeover bool
+
+	// If set, pipelines must come from bundles signed with this key.
+	BundleKey ed25519.PublicKey
 }
 
 func DefaultRuntimeOptions() RuntimeOptions {
@@ -378,7 +394,16 @@ func (self *Runtime) instantiatePipeline(src string, srcPath string, psid string
 	invocationData, _ := BuildDataForAst(ast)
 
 	// Instantiate the pipeline.
+	var bundles []*BundleInfo
 	if !readOnly {
+		if err := checkMroPin(src, mroPaths, mroVersion); err != nil {
+			return "", nil, nil, err
+		}
+		if self.Config.BundleKey != nil {
+			if bundles, err = verifyMroPathBundles(mroPaths, self.Config.BundleKey); err != nil {
+				return "", nil, nil, err
+			}
+		}
 		if err := CheckMinimalSpace(pipestancePath); err != nil {
 			return "", nil, nil, err
 		}
@@ -394,10 +419,14 @@ func (self *Runtime) instantiatePipeline(src string, srcPath string, psid string
 		if err := pipestance.Lock(); err != nil {
 			return "", nil, nil, err
 		}
+		pipestance.getNode().mkdirs()
+		if bundles != nil {
+			pipestance.metadata.Write(BundleFile, bundles)
+		}
+	} else {
+		pipestance.inspectOnly = true
 	}
 
-	pipestance.getNode().mkdirs()
-
 	return postsrc, ast, pipestance, nil
 }
 
@@ -532,7 +561,10 @@ func (self *Runtime) reattachToPipestance(psid string, pipestancePath string,
 
 	// If _metadata exists, unzip it so the pipestance can read its metadata.
 	metadataPath := path.Join(pipestancePath, MetadataZip.FileName())
-	if _, err := os.Stat(metadataPath); err == nil {
+	if _, err := os.Stat(metadataPath); err == nil && readOnly {
+		util.PrintInfo("runtime",
+			"Pipestance metadata is zipped.  Stage details will not be available.")
+	} else if err == nil {
 		if err := util.UnzipIgnoreExisting(metadataPath); err != nil {
 			pipestance.Unlock()
 			return nil, err
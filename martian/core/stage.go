@@ -8,6 +8,8 @@ package core
 
 import (
 	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"math"
@@ -198,6 +200,9 @@ func (self *Chunk) updateState(state MetadataFileName, uniquifier string) {
 	if beginState == Running || beginState == Queued {
 		if st, _ := self.metadata.getState(); st != Running && st != Queued {
 			self.fork.node.rt.JobManager.endJob(self.metadata)
+			if st == Complete {
+				self.metadata.recordOutputBytes()
+			}
 		}
 	}
 }
@@ -271,6 +276,7 @@ func (self *Chunk) Stage() *syntax.Stage {
 type Fork struct {
 	node           *Node
 	index          int
+	id             string
 	path           string
 	fqname         string
 	metadata       *Metadata
@@ -305,6 +311,7 @@ type Fork struct {
 // Exportable information from a Fork object.
 type ForkInfo struct {
 	Index         int                    `json:"index"`
+	Id            string                 `json:"id,omitempty"`
 	ArgPermute    map[string]interface{} `json:"argPermute"`
 	JoinDef       *JobResources          `json:"joinDef"`
 	State         MetadataState          `json:"state"`
@@ -315,6 +322,28 @@ type ForkInfo struct {
 	Bindings      *ForkBindingsInfo      `json:"bindings"`
 }
 
+// Maps a fork directory to the sweep values for that fork.
+type ForkIndexEntry struct {
+	Index int                    `json:"index"`
+	Id    string                 `json:"id"`
+	Args  map[string]interface{} `json:"args"`
+}
+
+// The sweep values, state, and outputs of a fork.
+type ForkSummaryInfo struct {
+	Index int                    `json:"index"`
+	Id    string                 `json:"id"`
+	State MetadataState          `json:"state"`
+	Args  map[string]interface{} `json:"args"`
+	Outs  LazyArgumentMap        `json:"outs,omitempty"`
+}
+
+// The summaries of all of the forks of a stage or pipeline.
+type NodeForkSummary struct {
+	Fqname string             `json:"fqname"`
+	Forks  []*ForkSummaryInfo `json:"forks"`
+}
+
 type ForkBindingsInfo struct {
 	Argument []*BindingInfo `json:"Argument"`
 	Return   []*BindingInfo `json:"Return"`
@@ -329,8 +358,9 @@ func NewFork(nodable Nodable, index int, argPermute map[string]interface{}) *For
 	self := &Fork{}
 	self.node = nodable.getNode()
 	self.index = index
-	self.path = path.Join(self.node.path, fmt.Sprintf("fork%d", index))
-	self.fqname = self.node.fqname + fmt.Sprintf(".fork%d", index)
+	self.id = forkId(self.node, index, argPermute)
+	self.path = path.Join(self.node.path, self.id)
+	self.fqname = self.node.fqname + "." + self.id
 	self.metadata = NewMetadata(self.fqname, self.path)
 	self.split_metadata = NewMetadata(self.fqname+".split", path.Join(self.path, "split"))
 	self.join_metadata = NewMetadata(self.fqname+".join", path.Join(self.path, "join"))
@@ -359,6 +389,50 @@ func NewFork(nodable Nodable, index int, argPermute map[string]interface{}) *For
 	return self
 }
 
+// Returns a fork directory name derived from a hash of the sweep values
+// which distinguish the fork, so that it does not change if the order of the
+// sweep values changes.
+func stableForkId(argPermute map[string]interface{}) string {
+	b, err := json.Marshal(argPermute)
+	if err != nil {
+		return ""
+	}
+	// Round-trip to normalize any raw json values.
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return ""
+	}
+	if b, err = json.Marshal(v); err != nil {
+		return ""
+	}
+	h := sha1.Sum(b)
+	return "fork_" + hex.EncodeToString(h[:6])
+}
+
+// Returns the name of the fork directory.  This is fork<index> unless
+// stable fork IDs were requested for forks with sweep arguments.  Whichever
+// naming scheme already exists on disk is used, so that restarting a
+// pipestance with different options doesn't re-run it.
+func forkId(node *Node, index int, argPermute map[string]interface{}) string {
+	legacy := fmt.Sprintf("fork%d", index)
+	if len(argPermute) == 0 {
+		return legacy
+	}
+	stable := stableForkId(argPermute)
+	if stable == "" {
+		return legacy
+	}
+	if node.rt.Config.StableForkIds {
+		if _, err := os.Stat(path.Join(node.path, legacy)); err == nil {
+			return legacy
+		}
+		return stable
+	} else if _, err := os.Stat(path.Join(node.path, stable)); err == nil {
+		return stable
+	}
+	return legacy
+}
+
 func (self *Fork) Split() bool {
 	if stage, ok := self.node.callable.(*syntax.Stage); ok {
 		return stage.Split
@@ -692,6 +766,9 @@ func (self *Fork) updateState(state, uniquifier string) {
 			uniquifier)
 		if st, _ := self.join_metadata.getState(); st != Running && st != Queued {
 			self.node.rt.JobManager.endJob(self.join_metadata)
+			if st == Complete {
+				self.join_metadata.recordOutputBytes()
+			}
 		}
 	} else {
 		self.metadata.cache(MetadataFileName(state), uniquifier)
@@ -854,26 +931,48 @@ func (self *Fork) step() {
 				Args:      MakeLazyArgumentMap(getBindings()),
 			}
 			self.join_metadata.Write(ArgsFile, &resolvedBindings)
-			self.join_metadata.Write(ChunkDefsFile, self.stageDefs.ChunkDefs)
+			chunkDefs := self.stageDefs.ChunkDefs
+			self.join_metadata.WriteLines(ChunkDefsFile, len(chunkDefs),
+				func(i int) interface{} { return chunkDefs[i] })
 			if self.Split() {
 				ok := true
-				chunkOuts := make([]interface{}, 0, len(self.chunks))
 				if len(self.chunks) > 0 {
-					readSize := self.node.rt.FreeMemBytes() / int64(2*len(self.chunks))
+					readSize := self.node.rt.FreeMemBytes() / 2
 					for _, chunk := range self.chunks {
-						if outs, err := chunk.metadata.read(OutsFile, readSize); err != nil {
+						if outs, err := chunk.metadata.read(OutsFile, readSize); isTransientIOError(err) {
+							// Try again once the filesystem recovers.
+							return
+						} else if err != nil {
 							chunk.metadata.WriteRaw(Errors, err.Error())
 							ok = false
 						} else {
-							chunkOuts = append(chunkOuts, outs)
 							ok = chunk.verifyOutput(outs) && ok
 						}
+						// Only hold one chunk's outs in memory at a time.
+						chunk.metadata.uncacheRead(OutsFile)
 					}
 				}
 				if !ok {
 					return
 				}
-				self.join_metadata.Write(ChunkOutsFile, chunkOuts)
+				// Read each chunk's outs again as it is written, rather
+				// than collecting them all first.
+				chunks := self.chunks
+				var readErr error
+				self.join_metadata.WriteLines(ChunkOutsFile, len(chunks),
+					func(i int) interface{} {
+						b, err := chunks[i].metadata.readRawBytes(OutsFile)
+						if err != nil && readErr == nil {
+							readErr = err
+						}
+						return json.RawMessage(b)
+					})
+				if readErr != nil {
+					if !isTransientIOError(readErr) {
+						self.join_metadata.WriteRaw(Errors, readErr.Error())
+					}
+					return
+				}
 				self.join_metadata.Write(OutsFile, makeOutArgs(self.OutParams(), self.join_metadata.curFilesPath, false))
 				if !self.join_has_run {
 					self.join_has_run = true
@@ -896,7 +995,9 @@ func (self *Fork) step() {
 			if len(self.OutParams().List) > 0 {
 				var err error
 				joinOut, err = self.join_metadata.read(OutsFile, self.node.rt.FreeMemBytes()/3)
-				if err != nil {
+				if isTransientIOError(err) {
+					return
+				} else if err != nil {
 					self.join_metadata.WriteRaw(Errors, err.Error())
 					return
 				} else if joinOut == nil {
@@ -928,7 +1029,7 @@ func (self *Fork) step() {
 				if alarms.Len() > 0 {
 					self.lastPrint = time.Now()
 					if len(self.node.forks) > 1 {
-						util.Print("Alerts for %s.fork%d:\n%s\n", self.node.fqname, self.index, alarms.String())
+						util.Print("Alerts for %s:\n%s\n", self.fqname, alarms.String())
 					} else {
 						util.Print("Alerts for %s:\n%s\n", self.node.fqname, alarms.String())
 					}
@@ -1037,8 +1138,8 @@ func (self *Fork) postProcess() {
 
 	// Handle multi-fork sweeps
 	if len(self.node.forks) > 1 {
-		outsPath = path.Join(outsPath, fmt.Sprintf("fork%d", self.index))
-		util.Print("\nOutputs (fork%d):\n", self.index)
+		outsPath = path.Join(outsPath, self.id)
+		util.Print("\nOutputs (%s):\n", self.id)
 	} else {
 		util.Print("\nOutputs:\n")
 	}
@@ -1164,7 +1265,7 @@ func (self *Fork) postProcess() {
 	if alarms.Len() > 0 {
 		self.lastPrint = time.Now()
 		if len(self.node.forks) > 1 {
-			util.Print("Alerts (fork%d):\n", self.index)
+			util.Print("Alerts (%s):\n", self.id)
 		} else {
 			util.Print("Alerts:\n")
 		}
@@ -1214,6 +1315,7 @@ func (self *Fork) serializeState() *ForkInfo {
 	}
 	return &ForkInfo{
 		Index:         self.index,
+		Id:            self.id,
 		ArgPermute:    self.argPermute,
 		JoinDef:       self.stageDefs.JoinDef,
 		State:         self.getState(),
@@ -1225,6 +1327,22 @@ func (self *Fork) serializeState() *ForkInfo {
 	}
 }
 
+func (self *Fork) summarize() *ForkSummaryInfo {
+	summary := &ForkSummaryInfo{
+		Index: self.index,
+		Id:    self.id,
+		State: self.getState(),
+		Args:  self.argPermute,
+	}
+	if summary.State == Complete {
+		var outs LazyArgumentMap
+		if err := self.metadata.ReadInto(OutsFile, &outs); err == nil {
+			summary.Outs = outs
+		}
+	}
+	return summary
+}
+
 func (self *Fork) getStages() []*StagePerfInfo {
 	stages := make([]*StagePerfInfo, 0, len(self.subforks)+1)
 	for _, subfork := range self.subforks {
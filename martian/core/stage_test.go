@@ -4,6 +4,7 @@ package core
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -101,3 +102,26 @@ func TestGetMaybeFileNames(t *testing.T) {
 		}
 	}
 }
+
+func TestStableForkId(t *testing.T) {
+	a := stableForkId(map[string]interface{}{
+		"x": json.RawMessage(`"foo"`),
+		"y": json.RawMessage(`[1, 2]`),
+	})
+	b := stableForkId(map[string]interface{}{
+		"y": []interface{}{1, 2},
+		"x": "foo",
+	})
+	if a != b {
+		t.Errorf("Expected %q == %q", a, b)
+	}
+	if !strings.HasPrefix(a, "fork_") {
+		t.Errorf("Unexpected fork id %q", a)
+	}
+	if c := stableForkId(map[string]interface{}{
+		"x": "bar",
+		"y": []interface{}{1, 2},
+	}); c == a {
+		t.Errorf("Expected different ids for different sweep values.")
+	}
+}
@@ -131,10 +131,12 @@ type (
 		MemNode      *AstNode
 		SpecialNode  *AstNode
 		VolatileNode *AstNode
+		WallTimeNode *AstNode
 
 		Special        string
 		Threads        int16
 		MemGB          int16
+		WallTimeHours  int16
 		StrictVolatile bool
 	}
 
@@ -249,6 +251,9 @@ func (s *Resources) getSubnodes() []AstNodable {
 	if s.VolatileNode != nil {
 		subs = append(subs, s.VolatileNode)
 	}
+	if s.WallTimeNode != nil {
+		subs = append(subs, s.WallTimeNode)
+	}
 	return subs
 }
 
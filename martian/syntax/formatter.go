@@ -517,36 +517,50 @@ func (self *Resources) format(printer *printer) {
 	printer.printComments(&self.Node, INDENT)
 	printer.WriteString(") using (\n")
 	// Pad depending on which arguments are present.
-	// mem_gb   = x,
-	// special  = y
-	// threads  = y,
-	// volatile = z,
-	var memPad, threadPad string
-	if self.VolatileNode != nil {
-		memPad = "  "
-		threadPad = " "
-	} else if self.SpecialNode != nil || self.ThreadNode != nil {
-		memPad = " "
+	// mem_gb         = x,
+	// special        = y
+	// threads        = y,
+	// volatile       = z,
+	// walltime_hours = w,
+	width := 0
+	for _, k := range [...]struct {
+		node *AstNode
+		id   string
+	}{
+		{self.MemNode, "mem_gb"},
+		{self.SpecialNode, "special"},
+		{self.ThreadNode, "threads"},
+		{self.VolatileNode, volatile},
+		{self.WallTimeNode, walltime_hours},
+	} {
+		if k.node != nil && len(k.id) > width {
+			width = len(k.id)
+		}
 	}
 	if self.MemNode != nil {
 		printer.printComments(self.MemNode, INDENT)
 		printer.WriteString(INDENT)
-		printer.Printf("mem_gb%s = %d,\n", memPad, self.MemGB)
+		printer.Printf("%-*s = %d,\n", width, "mem_gb", self.MemGB)
 	}
 	if self.SpecialNode != nil {
 		printer.printComments(self.SpecialNode, INDENT)
 		printer.WriteString(INDENT)
-		printer.Printf("special%s = \"%s\",\n", threadPad, self.Special)
+		printer.Printf("%-*s = \"%s\",\n", width, "special", self.Special)
 	}
 	if self.ThreadNode != nil {
 		printer.printComments(self.ThreadNode, INDENT)
 		printer.WriteString(INDENT)
-		printer.Printf("threads%s = %d,\n", threadPad, self.Threads)
+		printer.Printf("%-*s = %d,\n", width, "threads", self.Threads)
 	}
 	if self.VolatileNode != nil {
 		printer.printComments(self.VolatileNode, INDENT)
 		printer.WriteString(INDENT)
-		printer.WriteString("volatile = strict,\n")
+		printer.Printf("%-*s = strict,\n", width, volatile)
+	}
+	if self.WallTimeNode != nil {
+		printer.printComments(self.WallTimeNode, INDENT)
+		printer.WriteString(INDENT)
+		printer.Printf("%-*s = %d,\n", width, walltime_hours, self.WallTimeHours)
 	}
 }
 
@@ -911,9 +911,14 @@ mmdefault:
 		{
 			{
 				n := NewAstNode(mmDollar[2].loc, mmDollar[2].srcfile)
-				mmDollar[1].res.ThreadNode = &n
 				i := parseInt(mmDollar[4].val)
-				mmDollar[1].res.Threads = int16(i)
+				if isWallTimeToken(mmDollar[2].val) {
+					mmDollar[1].res.WallTimeNode = &n
+					mmDollar[1].res.WallTimeHours = int16(i)
+				} else {
+					mmDollar[1].res.ThreadNode = &n
+					mmDollar[1].res.Threads = int16(i)
+				}
 				mmVAL.res = mmDollar[1].res
 			}
 		}
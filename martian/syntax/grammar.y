@@ -205,9 +205,14 @@ resource_list
     | resource_list THREADS EQUALS NUM_INT COMMA
         {{
             n := NewAstNode($<loc>2, $<srcfile>2)
-            $1.ThreadNode = &n
             i := parseInt($4)
-            $1.Threads = int16(i)
+            if isWallTimeToken($2) {
+                $1.WallTimeNode = &n
+                $1.WallTimeHours = int16(i)
+            } else {
+                $1.ThreadNode = &n
+                $1.Threads = int16(i)
+            }
             $$ = $1
         }}
     | resource_list MEM_GB EQUALS NUM_INT COMMA
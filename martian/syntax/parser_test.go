@@ -803,6 +803,38 @@ stage SUM_SQUARES(
 	}
 }
 
+func TestWallTime(t *testing.T) {
+	t.Parallel()
+	src := `
+stage SUM_SQUARES(
+    in  float[] values,
+    in  int     walltime_hours,
+    out float   sum,
+    src py      "stages/sum_squares",
+) using (
+    threads        = 2,
+    walltime_hours = 12,
+)
+`
+	if ast := testGood(t, src); ast != nil {
+		if len(ast.Stages) != 1 {
+			t.Fatalf("Incorrect stage count %d", len(ast.Stages))
+		} else if res := ast.Stages[0].Resources; res == nil {
+			t.Fatal("No resources.")
+		} else {
+			if res.Threads != 2 {
+				t.Errorf("Expected 2 threads, saw %d", res.Threads)
+			}
+			if res.WallTimeHours != 12 {
+				t.Errorf("Expected 12 hours, saw %d", res.WallTimeHours)
+			}
+		}
+		if f := ast.format(false); f != src[1:] {
+			t.Errorf("Expected formatted source\n%s\ngot\n%s", src[1:], f)
+		}
+	}
+}
+
 func TestRetain(t *testing.T) {
 	t.Parallel()
 	if ast := testGood(t, `
@@ -8,7 +8,17 @@ import (
 	"regexp"
 )
 
-const default_out_name = "default"
+const (
+	default_out_name = "default"
+	walltime_hours   = "walltime_hours"
+)
+
+// The walltime_hours resource is lexed as a THREADS token, since it is
+// allowed in exactly the same places.  The grammar tells them apart by the
+// token text.
+func isWallTimeToken(val []byte) bool {
+	return string(val) == walltime_hours
+}
 
 // re matches text to produce token.
 type rule struct {
@@ -43,6 +53,7 @@ var rules = [...]rule{
 	{regexp.MustCompile(`^` + disabled + `\b`), DISABLED},
 	{regexp.MustCompile(`^` + strict + `\b`), STRICT},
 	{regexp.MustCompile(`^threads\b`), THREADS},
+	{regexp.MustCompile(`^` + walltime_hours + `\b`), THREADS}, // see isWallTimeToken
 	{regexp.MustCompile(`^mem_?gb\b`), MEM_GB},
 	{regexp.MustCompile(`^special\b`), SPECIAL},
 	{regexp.MustCompile(`^retain\b`), RETAIN},
@@ -0,0 +1,94 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+// Panic recovery and crash reports.
+//
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Information about a recovered panic.
+type CrashReport struct {
+	Component string `json:"component"`
+	Time      string `json:"time"`
+	Version   string `json:"version"`
+	Panic     string `json:"panic"`
+	Stack     string `json:"stack"`
+}
+
+var (
+	crashReportPath string
+	crashReportLock sync.Mutex
+)
+
+// Sets a file to which crash reports will be appended, one json object per
+// line, in addition to being written to the log.
+func SetCrashReportPath(p string) {
+	crashReportLock.Lock()
+	defer crashReportLock.Unlock()
+	crashReportPath = p
+}
+
+// Logs a crash report for the panic value r, including the stack of the
+// current goroutine.  This must be called from the deferred function which
+// called recover() in order for the stack to be useful.
+func ReportPanic(component string, r interface{}) *CrashReport {
+	var buf [16384]byte
+	report := &CrashReport{
+		Component: component,
+		Time:      Timestamp(),
+		Version:   GetVersion(),
+		Panic:     fmt.Sprint(r),
+		Stack:     string(buf[:runtime.Stack(buf[:], false)]),
+	}
+	PrintInfo(component, "Recovered from panic: %s\n\n%s",
+		report.Panic, report.Stack)
+	crashReportLock.Lock()
+	defer crashReportLock.Unlock()
+	if crashReportPath != "" {
+		if b, err := json.Marshal(report); err == nil {
+			if f, err := os.OpenFile(crashReportPath,
+				os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err == nil {
+				f.Write(append(b, '\n'))
+				f.Close()
+			}
+		}
+	}
+	return report
+}
+
+// Runs f, recovering and reporting any panic.  Returns true if f panicked.
+func RecoverPanic(component string, f func()) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			ReportPanic(component, r)
+			panicked = true
+		}
+	}()
+	f()
+	return false
+}
+
+// Runs f, restarting it after the given delay if it panics, up to
+// maxRestarts times.  Returns true if f returned normally, or false if the
+// restart limit was reached.
+func RunWithRestart(component string, maxRestarts int,
+	delay time.Duration, f func()) bool {
+	for i := 0; RecoverPanic(component, f); i++ {
+		if i >= maxRestarts {
+			PrintInfo(component, "Giving up after %d restarts.", maxRestarts)
+			return false
+		}
+		PrintInfo(component, "Restarting in %s.", delay)
+		time.Sleep(delay)
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+//
+// Copyright (c) 2017 10X Genomics, Inc. All rights reserved.
+//
+
+package util
+
+import (
+	"testing"
+)
+
+func TestRunWithRestart(t *testing.T) {
+	ENABLE_LOGGING = false
+	defer func() { ENABLE_LOGGING = true }()
+	calls := 0
+	if !RunWithRestart("test", 3, 0, func() {
+		calls++
+		if calls < 3 {
+			panic("test panic")
+		}
+	}) {
+		t.Error("Expected success after restarts.")
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls)
+	}
+	calls = 0
+	if RunWithRestart("test", 2, 0, func() {
+		calls++
+		panic("test panic")
+	}) {
+		t.Error("Expected failure after too many restarts.")
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls)
+	}
+}
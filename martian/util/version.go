@@ -80,6 +80,12 @@ func GetGitTag(dir string) (string, error) {
 	return runGit(dir, "describe", "--tags", "--dirty", "--always")
 }
 
+// Returns the output of running 'git rev-parse HEAD' in the given
+// directory, which is the full hash of the current commit.
+func GetGitCommit(dir string) (string, error) {
+	return runGit(dir, "rev-parse", "HEAD")
+}
+
 // Returns the output of running 'git rev-parse --abbrev-ref HEAD' in
 // the given directory, e.g. 'master'.
 func GetGitBranch(dir string) (string, error) {
@@ -231,6 +231,12 @@
     $scope.showRestart = true;
     $scope.showLog = false;
     $scope.perf = false;
+    $scope.compare = {
+      other: ''
+    };
+    $scope.invocation = {
+      editing: false
+    };
     $scope.charts = {};
     $scope.charttype = 'BarChart';
     $scope.tabs = {
@@ -387,6 +393,61 @@
       });
       return !found;
     };
+    $scope.editInvocation = function() {
+      return $scope.invocation = {
+        editing: true,
+        src: $scope.info.invokesrc
+      };
+    };
+    $scope.validateInvocation = function() {
+      $scope.invocation.result = null;
+      return $http.post("/api/validate-invocation/" + container + "/" + pname + "/" + psid + auth, $scope.invocation.src).success(function(result) {
+        return $scope.invocation.result = result;
+      }).error(function(data, status) {
+        return $scope.invocation.result = {
+          ok: false,
+          error: "Validation failed: error " + status + " (" + data + ")."
+        };
+      });
+    };
+    $scope.applyInvocation = function() {
+      if (!confirm("Replace the invocation and restart the pipestance?")) {
+        return;
+      }
+      return $http.post("/api/apply-invocation/" + container + "/" + pname + "/" + psid + auth, $scope.invocation.src).success(function(result) {
+        $scope.invocation = {
+          editing: false
+        };
+        return $scope.stopRefresh = $interval(function() {
+          return $scope.refresh();
+        }, 3000);
+      }).error(function(data, status) {
+        return $scope.invocation.result = {
+          ok: false,
+          error: "Restart failed: error " + status + " (" + data + ")."
+        };
+      });
+    };
+    $scope.humanizeTime = function(num) {
+      return humanize(num, 'seconds');
+    };
+    $scope.humanizeDelta = function(num) {
+      var sign;
+      sign = num < 0 ? '-' : '+';
+      return sign + humanize(Math.abs(num), 'seconds');
+    };
+    $scope.comparePipestance = function() {
+      var other, sep;
+      $scope.compare.result = null;
+      $scope.compare.error = null;
+      sep = auth ? '&' : '?';
+      other = encodeURIComponent($scope.compare.other);
+      return $http.get("/api/compare/" + container + "/" + pname + "/" + psid + auth + sep + "other=" + other).success(function(result) {
+        return $scope.compare.result = result;
+      }).error(function(data, status) {
+        return $scope.compare.error = "Comparison failed: error " + status + " (" + data + ").";
+      });
+    };
     return $scope.refresh = function() {
       $http.get("/api/get-state/" + container + "/" + pname + "/" + psid + auth).success(function(state) {
         $scope.nodes = _.indexBy(state.nodes, 'fqname');